@@ -0,0 +1,252 @@
+// Package audit finds rules that are redundant or conflict with each other
+// across the groups of a MagiTrickle configuration.
+package audit
+
+import (
+	"net/netip"
+	"strings"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+
+	"magitrickle-cli/matcher"
+	"magitrickle-cli/ruleset"
+)
+
+// Kinds of findings.
+const (
+	// KindDuplicate is a rule that exists more than once.
+	KindDuplicate = "duplicate"
+	// KindShadowed is a domain or namespace rule that a broader namespace
+	// or wildcard rule already matches, or a subnet inside another subnet
+	// of the same group.
+	KindShadowed = "shadowed"
+	// KindOverlap is a subnet that overlaps a subnet of another group.
+	KindOverlap = "overlap"
+	// KindDisabledShadowed is a disabled rule whose traffic is still
+	// routed by an enabled rule, so disabling it has no effect.
+	KindDisabledShadowed = "disabled-shadowed"
+)
+
+// Kinds lists all kinds of findings.
+var Kinds = []string{KindDuplicate, KindShadowed, KindOverlap, KindDisabledShadowed}
+
+// RuleRef identifies a rule and its group.
+type RuleRef struct {
+	GroupID   string `json:"group_id"`
+	Group     string `json:"group"`
+	Interface string `json:"interface"`
+	RuleID    string `json:"rule_id"`
+	Type      string `json:"type"`
+	Rule      string `json:"rule"`
+	// Enabled is false if the rule or its group is disabled.
+	Enabled bool `json:"enabled"`
+}
+
+// Finding reports Rule as a problem because of By.
+type Finding struct {
+	Kind string  `json:"kind"`
+	Rule RuleRef `json:"rule"`
+	By   RuleRef `json:"by"`
+	// Conflict is set when the two rules route through different
+	// interfaces, so it is undefined which one a connection takes.
+	Conflict bool `json:"conflict"`
+}
+
+// Check returns the findings for the groups, which must include their
+// rules. Findings are ordered by the position of Rule in groups.
+func Check(groups []types.GroupRes) []Finding {
+	var refs []RuleRef
+	for _, g := range groups {
+		if g.Rules == nil {
+			continue
+		}
+		for _, r := range *g.Rules {
+			refs = append(refs, RuleRef{
+				GroupID:   g.ID.String(),
+				Group:     g.Name,
+				Interface: g.Interface,
+				RuleID:    r.ID.String(),
+				Type:      r.Type,
+				Rule:      r.Rule,
+				Enabled:   g.Enable && r.Enable,
+			})
+		}
+	}
+
+	c := checker{refs: refs}
+	c.index()
+	for i := range refs {
+		if !c.duplicate(i) {
+			c.covered(i)
+		}
+	}
+	return c.findings
+}
+
+type checker struct {
+	refs     []RuleRef
+	findings []Finding
+
+	// byKey lists the rules with the same ruleset.Key, in order.
+	byKey map[string][]int
+	// namespaces maps a namespace to its rules.
+	namespaces map[string][]int
+	wildcards  []int
+	// subnets maps a masked prefix to its rules.
+	subnets map[netip.Prefix][]int
+}
+
+func (c *checker) index() {
+	c.byKey = make(map[string][]int)
+	c.namespaces = make(map[string][]int)
+	c.subnets = make(map[netip.Prefix][]int)
+	for i, r := range c.refs {
+		key := ruleset.Key(r.Type, r.Rule)
+		c.byKey[key] = append(c.byKey[key], i)
+		switch r.Type {
+		case ruleset.TypeNamespace:
+			c.namespaces[r.Rule] = append(c.namespaces[r.Rule], i)
+		case ruleset.TypeWildcard:
+			c.wildcards = append(c.wildcards, i)
+		case ruleset.TypeSubnet, ruleset.TypeSubnet6:
+			if p, err := netip.ParsePrefix(r.Rule); err == nil {
+				c.subnets[p.Masked()] = append(c.subnets[p.Masked()], i)
+			}
+		}
+	}
+}
+
+func (c *checker) add(kind string, i, by int) {
+	rule, other := c.refs[i], c.refs[by]
+	c.findings = append(c.findings, Finding{
+		Kind:     kind,
+		Rule:     rule,
+		By:       other,
+		Conflict: rule.GroupID != other.GroupID && rule.Interface != other.Interface,
+	})
+}
+
+// duplicate reports rule i if an earlier rule is the same, or, for a
+// disabled rule, if any enabled rule is the same.
+func (c *checker) duplicate(i int) bool {
+	same := c.byKey[ruleset.Key(c.refs[i].Type, c.refs[i].Rule)]
+	if !c.refs[i].Enabled {
+		for _, j := range same {
+			if c.refs[j].Enabled {
+				c.add(KindDisabledShadowed, i, j)
+				return true
+			}
+		}
+	}
+	for _, j := range same {
+		if j >= i {
+			break
+		}
+		if c.refs[j].Enabled == c.refs[i].Enabled {
+			c.add(KindDuplicate, i, j)
+			return true
+		}
+	}
+	return false
+}
+
+// covered reports rule i if a broader rule matches everything it does.
+func (c *checker) covered(i int) {
+	r := c.refs[i]
+	var by int
+	var found bool
+	switch r.Type {
+	case ruleset.TypeDomain, ruleset.TypeNamespace:
+		by, found = c.coveringDomainRule(i)
+	case ruleset.TypeSubnet, ruleset.TypeSubnet6:
+		c.coveringSubnets(i)
+		return
+	}
+	if !found {
+		return
+	}
+	switch {
+	case !r.Enabled:
+		c.add(KindDisabledShadowed, i, by)
+	case c.refs[by].Enabled:
+		c.add(KindShadowed, i, by)
+	}
+}
+
+// coveringDomainRule finds a namespace or wildcard rule, other than i,
+// that matches every name of the domain or namespace rule i. Enabled
+// rules are preferred.
+func (c *checker) coveringDomainRule(i int) (int, bool) {
+	r := c.refs[i]
+	candidates := c.parentNamespaces(r.Rule, r.Type == ruleset.TypeDomain)
+	for _, j := range c.wildcards {
+		w := c.refs[j].Rule
+		if !matcher.Wildcard(w, r.Rule) {
+			continue
+		}
+		// A namespace also needs its subdomains matched; wildcards that
+		// start with * and match one subdomain match all of them.
+		if r.Type == ruleset.TypeNamespace && !(strings.HasPrefix(w, "*") && matcher.Wildcard(w, "x."+r.Rule)) {
+			continue
+		}
+		candidates = append(candidates, j)
+	}
+
+	best, found := -1, false
+	for _, j := range candidates {
+		if j == i {
+			continue
+		}
+		if !found || c.refs[j].Enabled && !c.refs[best].Enabled {
+			best, found = j, true
+		}
+	}
+	return best, found
+}
+
+// parentNamespaces returns the namespace rules matching name: those of its
+// parent domains and, if self is set, of the name itself.
+func (c *checker) parentNamespaces(name string, self bool) []int {
+	var rules []int
+	if self {
+		rules = append(rules, c.namespaces[name]...)
+	}
+	for {
+		dot := strings.IndexByte(name, '.')
+		if dot < 0 {
+			return rules
+		}
+		name = name[dot+1:]
+		rules = append(rules, c.namespaces[name]...)
+	}
+}
+
+// coveringSubnets reports the enabled subnets containing subnet rule i,
+// the smallest one of each group.
+func (c *checker) coveringSubnets(i int) {
+	r := c.refs[i]
+	p, err := netip.ParsePrefix(r.Rule)
+	if err != nil {
+		return
+	}
+	p = p.Masked()
+	reported := make(map[string]bool)
+	for bits := p.Bits() - 1; bits >= 0; bits-- {
+		parent := netip.PrefixFrom(p.Addr(), bits).Masked()
+		for _, j := range c.subnets[parent] {
+			other := c.refs[j]
+			if !other.Enabled || reported[other.GroupID] {
+				continue
+			}
+			kind := KindOverlap
+			switch {
+			case !r.Enabled:
+				kind = KindDisabledShadowed
+			case other.GroupID == r.GroupID:
+				kind = KindShadowed
+			}
+			reported[other.GroupID] = true
+			c.add(kind, i, j)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"magitrickle-cli/policy"
+
+	"github.com/spf13/cobra"
+)
+
+var applyCmd = &cobra.Command{
+	Use:   "apply -f <FILE>",
+	Short: "Apply a declarative policy of groups and rules",
+	Long: `Reads a policy document (YAML or JSON) describing groups and their rules,
+compares it with the live state from /api/v1/groups?with_rules=true, prints
+the plan and applies it.
+
+Groups are matched by id when present, otherwise by name. When a group lists
+"rules", that list is authoritative: missing rules are deleted. Groups without
+a "rules" key keep their rules untouched. Live groups that are not in the
+policy are only removed with --prune.
+
+Example policy:
+    groups:
+      - name: Streaming
+        interface: nwg0
+        color: "#791a3e"
+        rules:
+          - name: YouTube
+            type: namespace
+            rule: youtube.com
+          - rule: netflix.com
+
+Example:
+    magitrickle apply -f policy.yaml --prune --save
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filePath, _ := cmd.Flags().GetString("filename")
+		prune, _ := cmd.Flags().GetBool("prune")
+		saveFlag, _ := cmd.Flags().GetBool("save")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		doc, err := loadPolicy(filePath)
+		if err != nil {
+			return err
+		}
+
+		c := newClient()
+		live, err := c.Groups().List(cmd.Context(), true)
+		if err != nil {
+			return err
+		}
+
+		plan, err := policy.NewPlan(doc, live, prune)
+		if err != nil {
+			return err
+		}
+
+		printPlan(plan)
+		if !plan.HasChanges() || dryRun {
+			return nil
+		}
+
+		err = plan.Apply(cmd.Context(), c, saveFlag)
+		snap := newSnapshot(cmd, args)
+		snap.addPlan(plan)
+		snap.save()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Policy applied successfully")
+		return nil
+	},
+}
+
+// loadPolicy reads a policy document from a file or "-" for stdin.
+func loadPolicy(filePath string) (*policy.Document, error) {
+	if filePath == "" {
+		return nil, errors.New("please specify --filename=<path> (or - for stdin)")
+	}
+
+	var r io.Reader = os.Stdin
+	if filePath != "-" {
+		f, err := os.Open(filePath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %w", filePath, err)
+		}
+		defer f.Close()
+		r = f
+	}
+
+	doc, err := policy.Load(r)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return doc, nil
+}
+
+// printPlan prints the plan in a terraform-like summary.
+func printPlan(plan *policy.Plan) {
+	if !plan.HasChanges() {
+		fmt.Println("No changes. Live state matches the policy.")
+		return
+	}
+
+	create, update, del := plan.Counts()
+	fmt.Printf("Plan: %d to create, %d to update, %d to delete\n", create, update, del)
+	for _, g := range plan.Groups {
+		switch g.Action {
+		case policy.ActionCreate:
+			fmt.Printf("  + group %q (interface: %s)\n", g.Name(), g.Desired.Interface)
+		case policy.ActionUpdate:
+			fmt.Printf("  ~ group %q (%s)\n", g.Name(), g.Live.ID.String())
+			for _, f := range g.Fields {
+				fmt.Printf("      %s: %s -> %s\n", f.Field, f.From, f.To)
+			}
+		case policy.ActionDelete:
+			fmt.Printf("  - group %q (%s)\n", g.Name(), g.Live.ID.String())
+			continue
+		default:
+			continue
+		}
+
+		for _, r := range g.Rules {
+			switch r.Action {
+			case policy.ActionCreate:
+				fmt.Printf("      + %s\n", ruleLabel(r.Desired.Name, r.Desired.RuleType(), r.Desired.Rule))
+			case policy.ActionUpdate:
+				fmt.Printf("      ~ rule %q (%s)\n", r.Desired.Name, r.Live.ID.String())
+				for _, f := range r.Fields {
+					fmt.Printf("          %s: %s -> %s\n", f.Field, f.From, f.To)
+				}
+			case policy.ActionDelete:
+				fmt.Printf("      - %s\n", ruleLabel(r.Live.Name, r.Live.Type, r.Live.Rule))
+			}
+		}
+	}
+}
+
+// ruleLabel describes a rule in plan output; rules are often unnamed.
+func ruleLabel(name, ruleType, value string) string {
+	if name == "" {
+		return fmt.Sprintf("rule (%s: %s)", ruleType, value)
+	}
+	return fmt.Sprintf("rule %q (%s: %s)", name, ruleType, value)
+}
+
+func init() {
+	applyCmd.Flags().StringP("filename", "f", "", "Policy file (YAML or JSON), - for stdin")
+	applyCmd.Flags().Bool("prune", false, "Delete live groups that are not in the policy")
+	applyCmd.Flags().Bool("save", false, "Save config after applying")
+	applyCmd.Flags().Bool("dry-run", false, "Only print the plan")
+	_ = applyCmd.MarkFlagFilename("filename", "yaml", "yml", "json")
+}
@@ -0,0 +1,118 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"magitrickle-cli/audit"
+
+	"github.com/spf13/cobra"
+)
+
+var auditView = resourceView[audit.Finding]{
+	columns: []tableColumn[audit.Finding]{
+		{header: "KIND", value: func(f audit.Finding) string { return f.Kind }},
+		{header: "GROUP", value: func(f audit.Finding) string { return f.Rule.Group }},
+		{header: "RULE", value: func(f audit.Finding) string { return f.Rule.Type + " " + f.Rule.Rule }},
+		{header: "RULE ID", wide: true, value: func(f audit.Finding) string { return f.Rule.RuleID }},
+		{header: "BY GROUP", value: func(f audit.Finding) string { return f.By.Group }},
+		{header: "BY RULE", value: func(f audit.Finding) string { return f.By.Type + " " + f.By.Rule }},
+		{header: "BY RULE ID", wide: true, value: func(f audit.Finding) string { return f.By.RuleID }},
+		{header: "CONFLICT", value: func(f audit.Finding) string {
+			if !f.Conflict {
+				return ""
+			}
+			return f.Rule.Interface + " vs " + f.By.Interface
+		}},
+	},
+	name: func(f audit.Finding) string { return f.Rule.GroupID + "/" + f.Rule.RuleID },
+}
+
+var auditCmd = &cobra.Command{
+	Use:   "audit",
+	Short: "Find duplicate, shadowed and overlapping rules",
+	Long: `Loads all groups with their rules and reports:
+
+  duplicate          the same rule more than once, in one or several groups
+  shadowed           a domain or namespace rule that a broader namespace or
+                     wildcard rule already matches, or a subnet inside
+                     another subnet of the same group
+  overlap            a subnet inside a subnet of another group
+  disabled-shadowed  a disabled rule whose domains or addresses are still
+                     matched by an enabled rule, so disabling it does nothing
+
+Findings between groups on different interfaces are marked as conflicts:
+which interface such traffic takes is undefined. Rules of disabled groups
+count as disabled; regex rules are not compared.
+
+Exits with status 1 if anything was found, so "audit -o json" can gate CI.
+Example:
+    magitrickle audit
+    magitrickle audit --conflicts-only -o json
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		ignore, _ := cmd.Flags().GetStringSlice("ignore")
+		conflictsOnly, _ := cmd.Flags().GetBool("conflicts-only")
+
+		ignored := make(map[string]bool, len(ignore))
+		for _, kind := range ignore {
+			if !slices.Contains(audit.Kinds, kind) {
+				return fmt.Errorf("unknown kind %q (want %s)", kind, strings.Join(audit.Kinds, ", "))
+			}
+			ignored[kind] = true
+		}
+
+		groups, err := newClient().Groups().List(cmd.Context(), true)
+		if err != nil {
+			return err
+		}
+
+		var findings []audit.Finding
+		for _, f := range audit.Check(groups) {
+			if !ignored[f.Kind] && (f.Conflict || !conflictsOnly) {
+				findings = append(findings, f)
+			}
+		}
+
+		err = printList(auditView, findings, func() {
+			if len(findings) == 0 {
+				fmt.Println("No problems found.")
+				return
+			}
+			_ = writeTable(os.Stdout, auditView, findings, false)
+			counts := make(map[string]int)
+			conflicts := 0
+			for _, f := range findings {
+				counts[f.Kind]++
+				if f.Conflict {
+					conflicts++
+				}
+			}
+			var parts []string
+			for _, kind := range audit.Kinds {
+				if counts[kind] > 0 {
+					parts = append(parts, fmt.Sprintf("%d %s", counts[kind], kind))
+				}
+			}
+			fmt.Printf("%d findings (%s), %d conflicts\n", len(findings), strings.Join(parts, ", "), conflicts)
+		})
+		if err != nil {
+			return err
+		}
+		if len(findings) > 0 {
+			cmd.SilenceErrors = true
+			return &exitError{code: 1, err: errors.New("audit found problems")}
+		}
+		return nil
+	},
+}
+
+func init() {
+	auditCmd.Flags().StringSlice("ignore", nil, "Kinds of findings to leave out: "+strings.Join(audit.Kinds, ", "))
+	auditCmd.Flags().Bool("conflicts-only", false, "Only report findings between groups on different interfaces")
+	_ = auditCmd.RegisterFlagCompletionFunc("ignore", cobra.FixedCompletions(audit.Kinds, cobra.ShellCompDirectiveNoFileComp))
+}
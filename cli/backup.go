@@ -0,0 +1,219 @@
+package cli
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+
+	"magitrickle-cli/constant"
+	"magitrickle-cli/policy"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	backupFormat = "magitrickle-backup"
+	// backupVersion is bumped on incompatible changes of backupArchive.
+	backupVersion = 1
+)
+
+// backupArchive is the on-disk backup format. Files ending in .gz are
+// gzip-compressed.
+type backupArchive struct {
+	Format     string           `json:"format"`
+	Version    int              `json:"version"`
+	CreatedAt  time.Time        `json:"created_at"`
+	CLIVersion string           `json:"cli_version"`
+	Commit     string           `json:"commit,omitempty"`
+	Source     string           `json:"source,omitempty"`
+	Groups     []types.GroupRes `json:"groups"`
+}
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	Short: "Export and restore the complete configuration",
+	Long: `Creates and restores backups of all groups and rules, including their IDs.
+A backup is a versioned JSON document (gzip-compressed if the file name ends
+in .gz).`,
+}
+
+var createBackupCmd = &cobra.Command{
+	Use:   "create",
+	Short: "Write a backup of all groups and rules",
+	Long: `Fetches all groups with their rules from /api/v1/groups?with_rules=true and
+writes them to --file (or stdout). Example:
+    magitrickle backup create --file=backup-$(date +%F).json.gz
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filePath, _ := cmd.Flags().GetString("file")
+
+		groups, err := newClient().Groups().List(cmd.Context(), true)
+		if err != nil {
+			return err
+		}
+		if groups == nil {
+			groups = []types.GroupRes{}
+		}
+
+		archive := backupArchive{
+			Format:     backupFormat,
+			Version:    backupVersion,
+			CreatedAt:  time.Now().UTC().Truncate(time.Second),
+			CLIVersion: constant.Version,
+			Commit:     constant.Commit,
+			Source:     describeConnection(Connection{Socket: clientOpts.SocketPath, Server: clientOpts.Server}),
+			Groups:     groups,
+		}
+
+		if filePath == "" || filePath == "-" {
+			return writeBackup(os.Stdout, archive, false)
+		}
+
+		f, err := os.OpenFile(filePath, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0o600)
+		if err != nil {
+			return fmt.Errorf("failed to create file %s: %w", filePath, err)
+		}
+		if err := writeBackup(f, archive, strings.HasSuffix(filePath, ".gz")); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+
+		rules := 0
+		for _, g := range groups {
+			if g.Rules != nil {
+				rules += len(*g.Rules)
+			}
+		}
+		fmt.Printf("Backup of %d groups and %d rules written to %s\n", len(groups), rules, filePath)
+		return nil
+	},
+}
+
+var restoreBackupCmd = &cobra.Command{
+	Use:   "restore <FILE>",
+	Short: "Restore groups and rules from a backup",
+	Long: `Restores a backup through the group and rule endpoints. Groups are matched
+by ID, then by name.
+
+  --merge    creates and updates the groups from the backup, keeping other
+             live groups
+  --replace  additionally deletes live groups that are not in the backup
+
+The planned changes are printed first; use --dry-run to stop there.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		replace, _ := cmd.Flags().GetBool("replace")
+		saveFlag, _ := cmd.Flags().GetBool("save")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		archive, err := readBackupFile(args[0])
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backup from %s (CLI %s, %d groups)\n",
+			archive.CreatedAt.Format(time.RFC3339), archive.CLIVersion, len(archive.Groups))
+
+		c := newClient()
+		live, err := c.Groups().List(cmd.Context(), true)
+		if err != nil {
+			return err
+		}
+
+		plan, err := policy.NewPlan(policy.FromGroups(archive.Groups), live, replace)
+		if err != nil {
+			return err
+		}
+		printPlan(plan)
+		if !plan.HasChanges() || dryRun {
+			return nil
+		}
+
+		err = plan.Apply(cmd.Context(), c, saveFlag)
+		snap := newSnapshot(cmd, args)
+		snap.addPlan(plan)
+		snap.save()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Backup restored successfully")
+		return nil
+	},
+}
+
+func writeBackup(w io.Writer, archive backupArchive, compress bool) error {
+	if compress {
+		gz := gzip.NewWriter(w)
+		if err := writeBackup(gz, archive, false); err != nil {
+			return err
+		}
+		return gz.Close()
+	}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(archive); err != nil {
+		return fmt.Errorf("failed to encode backup: %w", err)
+	}
+	return nil
+}
+
+// readBackupFile reads a plain or gzip-compressed backup, detected by its
+// content rather than its name.
+func readBackupFile(filePath string) (*backupArchive, error) {
+	content, err := os.ReadFile(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+
+	var r io.Reader = bytes.NewReader(content)
+	if len(content) > 2 && content[0] == 0x1f && content[1] == 0x8b {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decompress %s: %w", filePath, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	var archive backupArchive
+	if err := json.NewDecoder(r).Decode(&archive); err != nil {
+		return nil, fmt.Errorf("failed to parse backup %s: %w", filePath, err)
+	}
+	if archive.Format != backupFormat {
+		return nil, fmt.Errorf("%s is not a MagiTrickle backup", filePath)
+	}
+	if archive.Version > backupVersion {
+		return nil, fmt.Errorf("%s has backup version %d, this CLI supports up to %d", filePath, archive.Version, backupVersion)
+	}
+	if archive.Groups == nil {
+		return nil, errors.New("backup contains no groups list")
+	}
+	return &archive, nil
+}
+
+func init() {
+	backupCmd.AddCommand(createBackupCmd)
+	backupCmd.AddCommand(restoreBackupCmd)
+
+	createBackupCmd.Flags().StringP("file", "f", "", "Output file (default stdout); .gz enables compression")
+	_ = createBackupCmd.MarkFlagFilename("file", "json", "gz")
+
+	restoreBackupCmd.Flags().Bool("merge", false, "Create and update groups, keep groups missing from the backup")
+	restoreBackupCmd.Flags().Bool("replace", false, "Make the live configuration identical to the backup")
+	restoreBackupCmd.Flags().Bool("save", false, "Save config after restoring")
+	restoreBackupCmd.Flags().Bool("dry-run", false, "Only print the planned changes")
+	restoreBackupCmd.MarkFlagsMutuallyExclusive("merge", "replace")
+	restoreBackupCmd.MarkFlagsOneRequired("merge", "replace")
+}
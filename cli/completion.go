@@ -0,0 +1,214 @@
+package cli
+
+import (
+	"context"
+	"os"
+	"strings"
+	"time"
+
+	"magitrickle-cli/client"
+	"magitrickle-cli/ruleset"
+
+	"github.com/spf13/cobra"
+)
+
+var completionCmd = &cobra.Command{
+	Use:   "completion [bash|zsh|fish|powershell]",
+	Short: "Generate shell completion scripts",
+	Long: `Generates a completion script for the given shell. Group IDs, rule IDs
+and interfaces are completed from the running daemon, rule types from the
+types known to the CLI.
+
+Bash:
+    source <(magitrickle completion bash)
+    # or permanently:
+    magitrickle completion bash > /etc/bash_completion.d/magitrickle
+
+Zsh:
+    magitrickle completion zsh > "${fpath[1]}/_magitrickle"
+
+Fish:
+    magitrickle completion fish > ~/.config/fish/completions/magitrickle.fish
+
+PowerShell:
+    magitrickle completion powershell | Out-String | Invoke-Expression
+`,
+	ValidArgs:             []string{"bash", "zsh", "fish", "powershell"},
+	Args:                  cobra.MatchAll(cobra.ExactArgs(1), cobra.OnlyValidArgs),
+	DisableFlagsInUseLine: true,
+	// Generating a script needs neither the daemon nor a valid config.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		return nil
+	},
+	RunE: func(cmd *cobra.Command, args []string) error {
+		root := cmd.Root()
+		switch args[0] {
+		case "bash":
+			return root.GenBashCompletionV2(os.Stdout, true)
+		case "zsh":
+			return root.GenZshCompletion(os.Stdout)
+		case "fish":
+			return root.GenFishCompletion(os.Stdout, true)
+		default:
+			return root.GenPowerShellCompletionWithDesc(os.Stdout)
+		}
+	},
+}
+
+// completionTimeout keeps the shell responsive when the daemon is down.
+const completionTimeout = 3 * time.Second
+
+// completionClient returns a client for completion functions, which run
+// without rootCmd's PersistentPreRunE.
+func completionClient(cmd *cobra.Command) (*client.Client, context.Context, context.CancelFunc, bool) {
+	if err := resolveClientOptions(); err != nil {
+		return nil, nil, nil, false
+	}
+	clientOpts.Retries = 0
+	ctx, cancel := context.WithTimeout(cmd.Context(), completionTimeout)
+	return newClient(), ctx, cancel, true
+}
+
+// completeGroupIDs completes group IDs with the group name as description.
+func completeGroupIDs(cmd *cobra.Command, toComplete string) ([]string, cobra.ShellCompDirective) {
+	c, ctx, cancel, ok := completionClient(cmd)
+	if !ok {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	defer cancel()
+
+	groups, err := c.Groups().List(ctx, false)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var completions []string
+	for _, g := range groups {
+		if strings.HasPrefix(g.ID.String(), toComplete) {
+			completions = append(completions, g.ID.String()+"\t"+g.Name)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRuleIDs completes rule IDs of the group given as the first argument.
+func completeRuleIDs(cmd *cobra.Command, groupRef, toComplete string) ([]string, cobra.ShellCompDirective) {
+	c, ctx, cancel, ok := completionClient(cmd)
+	if !ok {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	defer cancel()
+
+	groupID, err := resolveGroupID(ctx, c, groupRef)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	rules, err := c.Rules().List(ctx, groupID)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var completions []string
+	for _, r := range rules {
+		if strings.HasPrefix(r.ID.String(), toComplete) {
+			completions = append(completions, r.ID.String()+"\t"+r.Name+" ("+r.Type+": "+r.Rule+")")
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// groupArgCompletion completes a single <GROUP_ID> argument.
+func groupArgCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeGroupIDs(cmd, toComplete)
+}
+
+// groupFileArgsCompletion completes <GROUP_ID> [FILE].
+func groupFileArgsCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) == 0 {
+		return completeGroupIDs(cmd, toComplete)
+	}
+	if len(args) == 1 {
+		return nil, cobra.ShellCompDirectiveDefault
+	}
+	return nil, cobra.ShellCompDirectiveNoFileComp
+}
+
+// groupRuleArgsCompletion completes the <GROUP_ID> <RULE_ID> argument pair.
+func groupRuleArgsCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	switch len(args) {
+	case 0:
+		return completeGroupIDs(cmd, toComplete)
+	case 1:
+		return completeRuleIDs(cmd, args[0], toComplete)
+	default:
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+}
+
+// completeInterfaces completes --interface from /api/v1/system/interfaces.
+func completeInterfaces(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	c, ctx, cancel, ok := completionClient(cmd)
+	if !ok {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	defer cancel()
+
+	ifaces, err := c.System().Interfaces(ctx)
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var completions []string
+	for _, iface := range ifaces {
+		if strings.HasPrefix(iface.ID, toComplete) {
+			completions = append(completions, iface.ID)
+		}
+	}
+	return completions, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRuleTypes completes --type with the known rule types.
+func completeRuleTypes(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return ruleset.RuleTypes, cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeRuleFormats completes --format of rule import/export.
+func completeRuleFormats(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return ruleset.FormatNames(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeOutputFormats completes -o/--output.
+func completeOutputFormats(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	formats := []string{outputJSON, outputYAML, outputTable, outputWide, outputName}
+	if strings.HasPrefix(toComplete, "t") || strings.HasPrefix(toComplete, "j") {
+		formats = append(formats, outputTemplate, outputJSONPath)
+	}
+	return formats, cobra.ShellCompDirectiveNoFileComp | cobra.ShellCompDirectiveNoSpace
+}
+
+// contextArgCompletion completes a single <NAME> context argument.
+func contextArgCompletion(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	if len(args) > 0 {
+		return nil, cobra.ShellCompDirectiveNoFileComp
+	}
+	return completeContexts(cmd, args, toComplete)
+}
+
+// completeContexts completes context names from the config file.
+func completeContexts(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	cfg, err := loadConfig()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+
+	var names []string
+	for name, conn := range cfg.Contexts {
+		if strings.HasPrefix(name, toComplete) && conn != nil {
+			names = append(names, name+"\t"+describeConnection(cfg.Connection.overlay(*conn)))
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
@@ -0,0 +1,269 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/spf13/cobra"
+)
+
+// configCmd groups commands that edit the local CLI config file.
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Manage CLI configuration and named contexts",
+	Long: `Manages named contexts stored in the CLI config file
+($XDG_CONFIG_HOME/magitrickle/config.yaml by default). A context bundles
+connection settings (socket or server, token, TLS files) for one router.
+Every command uses the current context unless --context is given.`,
+	// Config commands never talk to the daemon and must keep working even if
+	// the active context is broken, so client options are not resolved.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		output, err = parseOutputFormat(globalFlags.output)
+		return err
+	},
+}
+
+// contextEntry is a context as printed by get-contexts. The token itself is
+// never shown.
+type contextEntry struct {
+	Name               string `json:"name"`
+	Current            bool   `json:"current"`
+	Socket             string `json:"socket,omitempty"`
+	Server             string `json:"server,omitempty"`
+	HasToken           bool   `json:"has_token"`
+	CACert             string `json:"ca_cert,omitempty"`
+	ClientCert         string `json:"client_cert,omitempty"`
+	ClientKey          string `json:"client_key,omitempty"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+}
+
+var contextView = resourceView[contextEntry]{
+	columns: []tableColumn[contextEntry]{
+		{header: "CURRENT", value: func(c contextEntry) string {
+			if c.Current {
+				return "*"
+			}
+			return ""
+		}},
+		{header: "NAME", value: func(c contextEntry) string { return c.Name }},
+		{header: "CONNECTION", value: func(c contextEntry) string {
+			return describeConnection(Connection{Socket: c.Socket, Server: c.Server})
+		}},
+		{header: "TOKEN", wide: true, value: func(c contextEntry) string { return fmt.Sprint(c.HasToken) }},
+		{header: "CA-CERT", wide: true, value: func(c contextEntry) string { return c.CACert }},
+		{header: "CLIENT-CERT", wide: true, value: func(c contextEntry) string { return c.ClientCert }},
+		{header: "INSECURE", wide: true, value: func(c contextEntry) string { return fmt.Sprint(c.InsecureSkipVerify) }},
+	},
+	name: func(c contextEntry) string { return c.Name },
+}
+
+var getContextsCmd = &cobra.Command{
+	Use:   "get-contexts",
+	Short: "List all contexts",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+
+		names := make([]string, 0, len(cfg.Contexts))
+		for name := range cfg.Contexts {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		current := cfg.contextName()
+		entries := make([]contextEntry, 0, len(names))
+		for _, name := range names {
+			conn := cfg.Connection.overlay(*cfg.Contexts[name])
+			entries = append(entries, contextEntry{
+				Name:               name,
+				Current:            name == current,
+				Socket:             conn.Socket,
+				Server:             conn.Server,
+				HasToken:           conn.Token != "",
+				CACert:             conn.CACert,
+				ClientCert:         conn.ClientCert,
+				ClientKey:          conn.ClientKey,
+				InsecureSkipVerify: conn.insecureSkipVerify(),
+			})
+		}
+
+		return printList(contextView, entries, func() {
+			if len(entries) == 0 {
+				fmt.Println("No contexts found.")
+				return
+			}
+			for _, e := range entries {
+				marker := " "
+				if e.Current {
+					marker = "*"
+				}
+				fmt.Printf("%s %s\t%s\n", marker, e.Name, describeConnection(Connection{Socket: e.Socket, Server: e.Server}))
+			}
+		})
+	},
+}
+
+var currentContextCmd = &cobra.Command{
+	Use:   "current-context",
+	Short: "Print the current context",
+	Args:  cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if cfg.CurrentContext == "" {
+			return errors.New("current context is not set")
+		}
+		fmt.Println(cfg.CurrentContext)
+		return nil
+	},
+}
+
+var useContextCmd = &cobra.Command{
+	Use:   "use-context <NAME>",
+	Short: "Set the current context",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if _, ok := cfg.Contexts[name]; !ok {
+			return fmt.Errorf("context %q not found in config", name)
+		}
+
+		cfg.CurrentContext = name
+		if err := saveConfig(cfg); err != nil {
+			return err
+		}
+		fmt.Printf("Switched to context %q\n", name)
+		return nil
+	},
+}
+
+var setContextCmd = &cobra.Command{
+	Use:   "set-context <NAME>",
+	Short: "Create or modify a context",
+	Long: `Creates a context or updates an existing one with the connection flags
+that were given explicitly. Example:
+    magitrickle config set-context office --server=https://10.0.0.1:8443 --token=...
+    magitrickle config set-context home --socket=/opt/var/run/magitrickle.sock
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if cfg.Contexts == nil {
+			cfg.Contexts = make(map[string]*Connection)
+		}
+		ctx, exists := cfg.Contexts[name]
+		if !exists {
+			ctx = &Connection{}
+			cfg.Contexts[name] = ctx
+		}
+
+		flags := cmd.Flags()
+		if flags.Changed("socket") && flags.Changed("server") {
+			return errors.New("socket and server are mutually exclusive, specify only one of them")
+		}
+		if flags.Changed("socket") {
+			ctx.Socket, ctx.Server = globalFlags.socket, ""
+		}
+		if flags.Changed("server") {
+			ctx.Socket, ctx.Server = "", globalFlags.server
+		}
+		if flags.Changed("token") {
+			ctx.Token = globalFlags.token
+		}
+		if flags.Changed("ca-cert") {
+			ctx.CACert = globalFlags.caCert
+		}
+		if flags.Changed("client-cert") {
+			ctx.ClientCert = globalFlags.clientCert
+		}
+		if flags.Changed("client-key") {
+			ctx.ClientKey = globalFlags.clientKey
+		}
+		if flags.Changed("insecure-skip-verify") {
+			insecure := globalFlags.insecureSkipVerify
+			ctx.InsecureSkipVerify = &insecure
+		}
+		if cfg.CurrentContext == "" {
+			cfg.CurrentContext = name
+		}
+
+		if err := saveConfig(cfg); err != nil {
+			return err
+		}
+		if exists {
+			fmt.Printf("Context %q modified\n", name)
+		} else {
+			fmt.Printf("Context %q created\n", name)
+		}
+		return nil
+	},
+}
+
+var deleteContextCmd = &cobra.Command{
+	Use:     "delete-context <NAME>",
+	Aliases: []string{"rm-context"},
+	Short:   "Delete a context",
+	Args:    cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name := args[0]
+
+		cfg, err := loadConfig()
+		if err != nil {
+			return err
+		}
+		if _, ok := cfg.Contexts[name]; !ok {
+			return fmt.Errorf("context %q not found in config", name)
+		}
+
+		delete(cfg.Contexts, name)
+		if cfg.CurrentContext == name {
+			cfg.CurrentContext = ""
+		}
+		if err := saveConfig(cfg); err != nil {
+			return err
+		}
+		fmt.Printf("Context %q deleted\n", name)
+		return nil
+	},
+}
+
+// describeConnection summarizes a connection without exposing secrets.
+func describeConnection(c Connection) string {
+	switch {
+	case c.Server != "":
+		return c.Server
+	case c.Socket != "":
+		return "unix://" + c.Socket
+	default:
+		return "(default socket)"
+	}
+}
+
+func init() {
+	configCmd.AddCommand(getContextsCmd)
+	configCmd.AddCommand(currentContextCmd)
+	configCmd.AddCommand(useContextCmd)
+	configCmd.AddCommand(setContextCmd)
+	configCmd.AddCommand(deleteContextCmd)
+
+	for _, cmd := range []*cobra.Command{useContextCmd, setContextCmd, deleteContextCmd} {
+		cmd.ValidArgsFunction = contextArgCompletion
+	}
+}
@@ -0,0 +1,152 @@
+package cli
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	envSocket  = "MAGITRICKLE_SOCKET"
+	envServer  = "MAGITRICKLE_SERVER"
+	envToken   = "MAGITRICKLE_TOKEN"
+	envConfig  = "MAGITRICKLE_CONFIG"
+	envContext = "MAGITRICKLE_CONTEXT"
+)
+
+// Config is the on-disk CLI configuration
+// ($XDG_CONFIG_HOME/magitrickle/config.yaml by default).
+//
+// Top-level connection keys are defaults; a named context overrides them.
+type Config struct {
+	Connection     `yaml:",inline"`
+	CurrentContext string                 `yaml:"current-context,omitempty"`
+	Contexts       map[string]*Connection `yaml:"contexts,omitempty"`
+}
+
+// Connection describes how to reach one MagiTrickle daemon.
+type Connection struct {
+	Socket             string `yaml:"socket,omitempty"`
+	Server             string `yaml:"server,omitempty"`
+	Token              string `yaml:"token,omitempty"`
+	CACert             string `yaml:"ca-cert,omitempty"`
+	ClientCert         string `yaml:"client-cert,omitempty"`
+	ClientKey          string `yaml:"client-key,omitempty"`
+	InsecureSkipVerify *bool  `yaml:"insecure-skip-verify,omitempty"`
+}
+
+// overlay returns c with the fields set in o applied on top. Socket and
+// server are treated as one setting, so a context with a server does not
+// inherit a top-level socket.
+func (c Connection) overlay(o Connection) Connection {
+	if o.Socket != "" || o.Server != "" {
+		c.Socket, c.Server = o.Socket, o.Server
+	}
+	c.Token = firstNonEmpty(o.Token, c.Token)
+	c.CACert = firstNonEmpty(o.CACert, c.CACert)
+	c.ClientCert = firstNonEmpty(o.ClientCert, c.ClientCert)
+	c.ClientKey = firstNonEmpty(o.ClientKey, c.ClientKey)
+	if o.InsecureSkipVerify != nil {
+		c.InsecureSkipVerify = o.InsecureSkipVerify
+	}
+	return c
+}
+
+// insecureSkipVerify reports whether certificate verification is disabled.
+func (c Connection) insecureSkipVerify() bool {
+	return c.InsecureSkipVerify != nil && *c.InsecureSkipVerify
+}
+
+// contextName returns the selected context: --context, then
+// MAGITRICKLE_CONTEXT, then current-context from the config file.
+func (cfg *Config) contextName() string {
+	return firstNonEmpty(globalFlags.context, os.Getenv(envContext), cfg.CurrentContext)
+}
+
+// activeConnection returns the connection settings of the selected context.
+func (cfg *Config) activeConnection() (Connection, error) {
+	name := cfg.contextName()
+	if name == "" {
+		return cfg.Connection, nil
+	}
+	ctx, ok := cfg.Contexts[name]
+	if !ok || ctx == nil {
+		return Connection{}, fmt.Errorf("context %q not found in config", name)
+	}
+	return cfg.Connection.overlay(*ctx), nil
+}
+
+// defaultConfigPath returns the config location following the XDG spec.
+func defaultConfigPath() string {
+	dir := os.Getenv("XDG_CONFIG_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return ""
+		}
+		dir = filepath.Join(home, ".config")
+	}
+	return filepath.Join(dir, "magitrickle", "config.yaml")
+}
+
+// configPath returns the config file to use: --config, then
+// MAGITRICKLE_CONFIG, then the default location. explicit reports whether
+// the user asked for that file, in which case it must exist.
+func configPath() (path string, explicit bool) {
+	if globalFlags.config != "" {
+		return globalFlags.config, true
+	}
+	if env := os.Getenv(envConfig); env != "" {
+		return env, true
+	}
+	return defaultConfigPath(), false
+}
+
+// loadConfig reads the config file. A missing default config is not an error.
+func loadConfig() (*Config, error) {
+	cfg := &Config{}
+	path, explicit := configPath()
+	if path == "" {
+		return cfg, nil
+	}
+
+	content, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) && !explicit {
+			return cfg, nil
+		}
+		return nil, fmt.Errorf("failed to read config %s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(content, cfg); err != nil {
+		return nil, fmt.Errorf("failed to parse config %s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+// saveConfig writes cfg back to the config file. The file may hold tokens,
+// so it is only readable by the owner.
+func saveConfig(cfg *Config) error {
+	path, _ := configPath()
+	if path == "" {
+		return errors.New("cannot determine config file location, use --config")
+	}
+
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(cfg); err != nil {
+		return fmt.Errorf("failed to encode config: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return fmt.Errorf("failed to create config directory: %w", err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		return fmt.Errorf("failed to write config %s: %w", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,172 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+
+	"magitrickle-cli/client"
+	"magitrickle-cli/policy"
+
+	"github.com/spf13/cobra"
+)
+
+var diffCmd = &cobra.Command{
+	Use:   "diff -f <FILE>",
+	Short: "Show differences between a policy file and the running configuration",
+	Long: `Compares a policy document (see "magitrickle apply --help") with the live
+groups and rules and prints a unified diff: "-" lines are the running
+configuration, "+" lines are the policy. Groups and rules are matched the same
+way as by apply. Live groups missing from the policy are only reported with
+--prune.
+
+Exit status is 0 when there is no drift and 1 when there is drift; errors
+exit with the usual codes (2 for an unreadable policy file, 3 if the daemon
+is not reachable, ...), so the command can be used as a drift check:
+    magitrickle diff -f policy.yaml >/dev/null || alert "routing drift"
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filePath, _ := cmd.Flags().GetString("filename")
+		prune, _ := cmd.Flags().GetBool("prune")
+		colorMode, _ := cmd.Flags().GetString("color")
+
+		colored, err := useColor(colorMode)
+		if err != nil {
+			return withClass(err, errUsage)
+		}
+
+		// Errors must not exit with status 1, which means drift.
+		doc, err := loadPolicy(filePath)
+		if err != nil {
+			return withClass(err, errUsage)
+		}
+		live, err := newClient().Groups().List(cmd.Context(), true)
+		if err != nil {
+			return err
+		}
+		plan, err := policy.NewPlan(doc, live, prune)
+		if err != nil {
+			return withClass(err, client.ErrValidation)
+		}
+
+		if !plan.HasChanges() {
+			return nil
+		}
+
+		d := diffPrinter{colored: colored}
+		d.header("--- live")
+		d.header("+++ " + filePath)
+		for _, g := range plan.Groups {
+			d.group(g)
+		}
+
+		cmd.SilenceErrors = true
+		return &exitError{code: 1, err: errors.New("drift detected")}
+	},
+}
+
+// ANSI colours used by the diff output.
+const (
+	ansiReset = "\x1b[0m"
+	ansiBold  = "\x1b[1m"
+	ansiRed   = "\x1b[31m"
+	ansiGreen = "\x1b[32m"
+	ansiCyan  = "\x1b[36m"
+)
+
+// useColor decides whether to colourise output for --color=auto|always|never.
+func useColor(mode string) (bool, error) {
+	switch mode {
+	case "always":
+		return true, nil
+	case "never":
+		return false, nil
+	case "auto":
+		if os.Getenv("NO_COLOR") != "" {
+			return false, nil
+		}
+		fi, err := os.Stdout.Stat()
+		return err == nil && fi.Mode()&os.ModeCharDevice != 0, nil
+	default:
+		return false, fmt.Errorf("invalid --color %q (want auto, always or never)", mode)
+	}
+}
+
+type diffPrinter struct {
+	colored bool
+}
+
+func (d diffPrinter) line(color, prefix, text string) {
+	if d.colored && color != "" {
+		fmt.Printf("%s%s%s%s\n", color, prefix, text, ansiReset)
+		return
+	}
+	fmt.Printf("%s%s\n", prefix, text)
+}
+
+func (d diffPrinter) header(text string)  { d.line(ansiBold, "", text) }
+func (d diffPrinter) hunk(text string)    { d.line(ansiCyan, "", "@@ "+text+" @@") }
+func (d diffPrinter) removed(text string) { d.line(ansiRed, "-", text) }
+func (d diffPrinter) added(text string)   { d.line(ansiGreen, "+", text) }
+func (d diffPrinter) context(text string) { d.line("", " ", text) }
+
+func (d diffPrinter) fields(indent string, fields []policy.FieldChange) {
+	for _, f := range fields {
+		d.removed(indent + f.Field + ": " + f.From)
+	}
+	for _, f := range fields {
+		d.added(indent + f.Field + ": " + f.To)
+	}
+}
+
+func (d diffPrinter) group(g policy.GroupChange) {
+	switch g.Action {
+	case policy.ActionCreate:
+		d.hunk(fmt.Sprintf("group %q (new)", g.Name()))
+		d.added("  name: " + strconv.Quote(g.Desired.Name))
+		d.added("  interface: " + strconv.Quote(g.Desired.Interface))
+		if g.Desired.Color != "" {
+			d.added("  color: " + strconv.Quote(g.Desired.Color))
+		}
+		d.added("  enable: " + strconv.FormatBool(g.Desired.Enabled()))
+	case policy.ActionDelete:
+		d.hunk(fmt.Sprintf("group %q (%s)", g.Name(), g.Live.ID.String()))
+		d.removed("  name: " + strconv.Quote(g.Live.Name))
+		d.removed("  interface: " + strconv.Quote(g.Live.Interface))
+		d.removed("  color: " + strconv.Quote(g.Live.Color))
+		d.removed("  enable: " + strconv.FormatBool(g.Live.Enable))
+		if g.Live.Rules != nil {
+			for _, r := range *g.Live.Rules {
+				d.removed("  " + ruleLabel(r.Name, r.Type, r.Rule))
+			}
+		}
+		return
+	case policy.ActionUpdate:
+		d.hunk(fmt.Sprintf("group %q (%s)", g.Name(), g.Live.ID.String()))
+		d.fields("  ", g.Fields)
+	default:
+		return
+	}
+
+	for _, r := range g.Rules {
+		switch r.Action {
+		case policy.ActionCreate:
+			d.added("  " + ruleLabel(r.Desired.Name, r.Desired.RuleType(), r.Desired.Rule))
+		case policy.ActionDelete:
+			d.removed("  " + ruleLabel(r.Live.Name, r.Live.Type, r.Live.Rule))
+		case policy.ActionUpdate:
+			d.context(fmt.Sprintf("  rule %q (%s):", r.Live.Name, r.Live.ID.String()))
+			d.fields("    ", r.Fields)
+		}
+	}
+}
+
+func init() {
+	diffCmd.Flags().StringP("filename", "f", "", "Policy file (YAML or JSON), - for stdin")
+	diffCmd.Flags().Bool("prune", false, "Report live groups that are not in the policy")
+	diffCmd.Flags().String("color", "auto", "Colourise output: auto, always or never")
+	_ = diffCmd.MarkFlagFilename("filename", "yaml", "yml", "json")
+	_ = diffCmd.RegisterFlagCompletionFunc("color", cobra.FixedCompletions([]string{"auto", "always", "never"}, cobra.ShellCompDirectiveNoFileComp))
+}
@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"magitrickle-cli/client"
+
+	"github.com/spf13/cobra"
+)
+
+// Exit codes, documented in the README.
+const (
+	exitFailure      = 1 // any other error, or a failed check (diff, audit, lint, match)
+	exitUsage        = 2 // invalid command, arguments or flags
+	exitConnection   = 3 // the daemon is not reachable
+	exitNotFound     = 4 // a group, rule or other object does not exist
+	exitValidation   = 5 // the request was rejected as invalid
+	exitConflict     = 6
+	exitServer       = 7 // the daemon failed with a 5xx status
+	exitUnauthorized = 8
+)
+
+// errUsage classifies errors in how the command was invoked.
+var errUsage = errors.New("usage error")
+
+// errSetup classifies failures to load the config or TLS files. They happen
+// before the command starts but are not usage errors.
+var errSetup = errors.New("setup error")
+
+// classError attaches an error class to err without changing its message.
+type classError struct {
+	err   error
+	class error
+}
+
+func (e *classError) Error() string   { return e.err.Error() }
+func (e *classError) Unwrap() []error { return []error{e.err, e.class} }
+
+func withClass(err, class error) error {
+	return &classError{err: err, class: class}
+}
+
+// exitCode maps err to the exit status of the process.
+func exitCode(err error) int {
+	var exitErr *exitError
+	switch {
+	case errors.As(err, &exitErr):
+		return exitErr.code
+	case errors.Is(err, errUsage):
+		return exitUsage
+	case errors.Is(err, client.ErrConnection):
+		return exitConnection
+	case errors.Is(err, client.ErrNotFound):
+		return exitNotFound
+	case errors.Is(err, client.ErrValidation):
+		return exitValidation
+	case errors.Is(err, client.ErrConflict):
+		return exitConflict
+	case errors.Is(err, client.ErrServer):
+		return exitServer
+	case errors.Is(err, client.ErrUnauthorized):
+		return exitUnauthorized
+	}
+	return exitFailure
+}
+
+// printError writes err to stderr. An exitError of a command that set
+// SilenceErrors only carries the status of an outcome the command already
+// reported. Usage errors point to the help of the command.
+func printError(cmd *cobra.Command, err error) {
+	var exitErr *exitError
+	if errors.As(err, &exitErr) && cmd.SilenceErrors {
+		return
+	}
+	fmt.Fprintln(os.Stderr, "Error:", err)
+	if errors.Is(err, errUsage) {
+		fmt.Fprintf(os.Stderr, "Run '%s --help' for usage.\n", cmd.CommandPath())
+	}
+}
+
+// commandStarted is set once the RunE of the invoked command is entered.
+// cobra returns unknown commands, invalid arguments and missing flags as
+// plain errors, so every error before that point is a usage error.
+var commandStarted bool
+
+// prepareCommands tracks when a command starts and makes parent commands
+// reject unknown subcommands; cobra only does that for the root and shows
+// the help with status 0 otherwise.
+func prepareCommands(cmd *cobra.Command) {
+	if run := cmd.RunE; run != nil {
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			commandStarted = true
+			return run(cmd, args)
+		}
+	} else if !cmd.Runnable() && cmd.HasParent() && cmd.HasSubCommands() {
+		cmd.Args = cobra.NoArgs
+		cmd.RunE = func(cmd *cobra.Command, args []string) error {
+			return cmd.Help()
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		prepareCommands(sub)
+	}
+}
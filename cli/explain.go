@@ -0,0 +1,219 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+
+	"magitrickle-cli/matcher"
+	"magitrickle-cli/resolver"
+	"magitrickle-cli/ruleset"
+
+	"github.com/spf13/cobra"
+)
+
+// explanation is the result of resolving a name and matching every step.
+type explanation struct {
+	Name      string           `json:"name"`
+	Resolver  string           `json:"resolver"`
+	Steps     []explainStep    `json:"steps"`
+	Addresses []explainAddress `json:"addresses"`
+	// Routes are the groups the addresses are added to, in configuration
+	// order; the first one wins.
+	Routes    []explainRoute `json:"routes"`
+	Interface string         `json:"interface"`
+}
+
+type explainStep struct {
+	resolver.Step
+	Matches []matcher.Match `json:"matches"`
+}
+
+type explainAddress struct {
+	Address netip.Addr      `json:"address"`
+	Matches []matcher.Match `json:"matches"`
+}
+
+type explainRoute struct {
+	GroupID   string `json:"group_id"`
+	Group     string `json:"group"`
+	Interface string `json:"interface"`
+	// Via is the rule that selects the group and what it matched.
+	Via  string `json:"via"`
+	Wins bool   `json:"wins"`
+}
+
+var explainView = resourceView[explanation]{
+	columns: []tableColumn[explanation]{
+		{header: "NAME", value: func(e explanation) string { return e.Name }},
+		{header: "CHAIN", value: func(e explanation) string {
+			names := make([]string, len(e.Steps))
+			for i, s := range e.Steps {
+				names[i] = s.Name
+			}
+			return strings.Join(names, " -> ")
+		}},
+		{header: "ADDRESSES", value: func(e explanation) string {
+			addrs := make([]string, len(e.Addresses))
+			for i, a := range e.Addresses {
+				addrs[i] = a.Address.String()
+			}
+			return strings.Join(addrs, ",")
+		}},
+		{header: "GROUPS", value: func(e explanation) string {
+			groups := make([]string, len(e.Routes))
+			for i, r := range e.Routes {
+				groups[i] = r.Group
+			}
+			return strings.Join(groups, ",")
+		}},
+		{header: "INTERFACE", value: func(e explanation) string { return e.Interface }},
+		{header: "RESOLVER", wide: true, value: func(e explanation) string { return e.Resolver }},
+	},
+	name: func(e explanation) string { return e.Name },
+}
+
+// explainRoutes lists every group with an active rule matching a name of
+// the chain or one of the addresses, in configuration order.
+func explainRoutes(groups []types.GroupRes, steps []explainStep, addrs []explainAddress) []explainRoute {
+	via := make(map[string]string)
+	note := func(matches []matcher.Match, target string) {
+		for _, m := range matches {
+			if _, ok := via[m.GroupID]; m.Active && !ok {
+				via[m.GroupID] = fmt.Sprintf("%s %s (%s)", m.Rule.Type, m.Rule.Rule, target)
+			}
+		}
+	}
+	for _, s := range steps {
+		note(s.Matches, s.Name)
+	}
+	for _, a := range addrs {
+		note(a.Matches, a.Address.String())
+	}
+
+	var routes []explainRoute
+	for _, g := range groups {
+		if v, ok := via[g.ID.String()]; ok {
+			routes = append(routes, explainRoute{
+				GroupID:   g.ID.String(),
+				Group:     g.Name,
+				Interface: g.Interface,
+				Via:       v,
+				Wins:      len(routes) == 0,
+			})
+		}
+	}
+	return routes
+}
+
+func printMatches(matches []matcher.Match) {
+	if len(matches) == 0 {
+		fmt.Println("     no matching rules")
+		return
+	}
+	for _, m := range matches {
+		state := ""
+		if !m.Active {
+			state = " [" + matchState(m) + "]"
+		}
+		fmt.Printf("     %s (%s): %s %s%s\n", m.Group, m.Interface, m.Rule.Type, m.Rule.Rule, state)
+	}
+}
+
+var explainCmd = &cobra.Command{
+	Use:   "explain <DOMAIN>",
+	Short: "Resolve a domain and show which rules route it",
+	Long: `Resolves the domain through a DNS server (--resolver, by default the first
+nameserver of /etc/resolv.conf), follows its CNAME chain and shows for every
+name and every resulting address which rules match, as "match" does.
+
+The daemon adds the addresses to every group with an enabled rule matching
+any name of the chain (or, for subnet rules, the address). The first of
+these groups in configuration order is marked as the one whose interface
+the traffic takes.
+
+Exits with status 1 if no enabled rule matches.
+Example:
+    magitrickle explain www.youtube.com
+    magitrickle explain www.youtube.com --resolver=192.168.1.1 -o json
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		server, _ := cmd.Flags().GetString("resolver")
+
+		name, err := ruleset.NormalizeDomain(args[0])
+		if err != nil {
+			return err
+		}
+		groups, err := newClient().Groups().List(cmd.Context(), true)
+		if err != nil {
+			return err
+		}
+
+		r := resolver.Resolver{Server: server}
+		chain, err := r.Resolve(cmd.Context(), name)
+		if err != nil {
+			return fmt.Errorf("failed to resolve %s via %s: %w", name, r.Address(), err)
+		}
+
+		m := matcher.New(groups)
+		e := explanation{Name: name, Resolver: r.Address()}
+		for _, step := range chain {
+			e.Steps = append(e.Steps, explainStep{Step: step, Matches: m.Domain(step.Name)})
+			for _, addr := range step.Addrs {
+				e.Addresses = append(e.Addresses, explainAddress{Address: addr, Matches: m.IP(addr)})
+			}
+		}
+		e.Routes = explainRoutes(groups, e.Steps, e.Addresses)
+		if len(e.Routes) > 0 {
+			e.Interface = e.Routes[0].Interface
+		}
+
+		err = printItem(explainView, e, func() {
+			fmt.Printf("Resolving %s via %s\n", name, e.Resolver)
+			for _, s := range e.Steps {
+				if s.CNAME != "" {
+					fmt.Printf(" %s  CNAME %s\n", s.Name, s.CNAME)
+				} else if len(s.Addrs) == 0 {
+					fmt.Printf(" %s  no addresses\n", s.Name)
+				} else {
+					fmt.Printf(" %s\n", s.Name)
+				}
+				printMatches(s.Matches)
+			}
+			for _, a := range e.Addresses {
+				fmt.Printf(" %s\n", a.Address)
+				printMatches(a.Matches)
+			}
+
+			if len(e.Routes) == 0 {
+				fmt.Println("No enabled rule matches, the traffic is not routed by MagiTrickle.")
+				return
+			}
+			fmt.Println("The addresses are added to:")
+			for _, route := range e.Routes {
+				marker := " "
+				if route.Wins {
+					marker = "*"
+				}
+				fmt.Printf(" %s %s (%s) via %s\n", marker, route.Group, route.Interface, route.Via)
+			}
+			fmt.Printf("Traffic to %s leaves through %s.\n", name, e.Interface)
+		})
+		if err != nil {
+			return err
+		}
+		if len(e.Routes) == 0 {
+			cmd.SilenceErrors = true
+			return &exitError{code: 1, err: errors.New("no enabled rule matches")}
+		}
+		return nil
+	},
+}
+
+func init() {
+	explainCmd.Flags().String("resolver", "", "DNS server to query, host or host:port (default from /etc/resolv.conf)")
+}
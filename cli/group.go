@@ -1,22 +1,46 @@
 package cli
 
 import (
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
-	"strings"
+	"strconv"
 
 	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
 
 	"github.com/spf13/cobra"
 )
 
+// groupView renders groups for the shared -o formats.
+var groupView = resourceView[types.GroupRes]{
+	columns: []tableColumn[types.GroupRes]{
+		{header: "ID", value: func(g types.GroupRes) string { return g.ID.String() }},
+		{header: "NAME", value: func(g types.GroupRes) string { return g.Name }},
+		{header: "INTERFACE", value: func(g types.GroupRes) string { return g.Interface }},
+		{header: "ENABLED", value: func(g types.GroupRes) string { return boolString(g.Enable) }},
+		{header: "COLOR", wide: true, value: func(g types.GroupRes) string { return g.Color }},
+		{header: "RULES", wide: true, value: func(g types.GroupRes) string {
+			if g.Rules == nil {
+				return "-"
+			}
+			return strconv.Itoa(len(*g.Rules))
+		}},
+	},
+	name: func(g types.GroupRes) string { return g.ID.String() },
+}
+
+func printGroupDetails(g *types.GroupRes) {
+	fmt.Printf(" ID: %s\n Name: %s\n Interface: %s\n Enabled: %v\n Color: %s\n",
+		g.ID.String(), g.Name, g.Interface, g.Enable, g.Color)
+}
+
 var groupCmd = &cobra.Command{
 	Use:   "group",
 	Short: "Manage groups (list, create, update, delete, etc.)",
 	Long: `Allows listing existing groups, creating new groups, updating or 
-removing them. Under the hood, this command calls /api/v1/groups endpoints.`,
+removing them. Under the hood, this command calls /api/v1/groups endpoints.
+
+Wherever a GROUP_ID is expected you may also pass a unique ID prefix (at
+least 4 characters) or the group name (exact, or case-insensitive if unique).`,
 }
 
 var listgroupCmd = &cobra.Command{
@@ -27,46 +51,33 @@ var listgroupCmd = &cobra.Command{
 Use --with-rules to include rule details in the response.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
 		withRules, _ := cmd.Flags().GetBool("with-rules")
-		url := "/api/v1/groups"
-		if withRules {
-			url += "?with_rules=true"
-		}
 
-		resp, err := doUnixRequest(http.MethodGet, url, nil)
+		groups, err := newClient().Groups().List(cmd.Context(), withRules)
 		if err != nil {
 			return err
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			return parseAPIError(resp)
-		}
-
-		var groupsRes types.GroupsRes
-		if err := json.NewDecoder(resp.Body).Decode(&groupsRes); err != nil {
-			return fmt.Errorf("failed to decode GroupsRes: %w", err)
-		}
-
-		if groupsRes.Groups == nil || len(*groupsRes.Groups) == 0 {
-			fmt.Println("No groups found.")
-			return nil
-		}
 
-		fmt.Println("Groups:")
-		for _, g := range *groupsRes.Groups {
-			fmt.Printf(" - ID: %s\n   Name: %s\n   Interface: %s\n   Enabled: %v\n   Color: %s\n",
-				g.ID.String(), g.Name, g.Interface, g.Enable, g.Color)
+		return printList(groupView, groups, func() {
+			if len(groups) == 0 {
+				fmt.Println("No groups found.")
+				return
+			}
 
-			if withRules && g.Rules != nil && len(*g.Rules) > 0 {
-				fmt.Println("   Rules:")
-				for _, r := range *g.Rules {
-					fmt.Printf("     * %s (%s) => %s [enabled: %v]\n",
-						r.Name, r.Type, r.Rule, r.Enable)
+			fmt.Println("Groups:")
+			for _, g := range groups {
+				fmt.Printf(" - ID: %s\n   Name: %s\n   Interface: %s\n   Enabled: %v\n   Color: %s\n",
+					g.ID.String(), g.Name, g.Interface, g.Enable, g.Color)
+
+				if withRules && g.Rules != nil && len(*g.Rules) > 0 {
+					fmt.Println("   Rules:")
+					for _, r := range *g.Rules {
+						fmt.Printf("     * %s (%s) => %s [enabled: %v]\n",
+							r.Name, r.Type, r.Rule, r.Enable)
+					}
 				}
+				fmt.Println()
 			}
-			fmt.Println()
-		}
-		return nil
+		})
 	},
 }
 
@@ -90,25 +101,18 @@ the config will be saved immediately on the server side.`,
 			Enable:    &enable,
 		}
 
-		resp, err := doUnixJSON(http.MethodPost, "/api/v1/groups", reqBody)
+		groupRes, err := newClient().Groups().Create(cmd.Context(), reqBody, false)
 		if err != nil {
 			return err
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			return parseAPIError(resp)
-		}
-
-		var groupRes types.GroupRes
-		if err := json.NewDecoder(resp.Body).Decode(&groupRes); err != nil {
-			return fmt.Errorf("failed to decode GroupRes: %w", err)
-		}
+		snap := newSnapshot(cmd, args)
+		snap.created(groupRes.ID)
+		snap.save()
 
-		fmt.Println("Group created successfully")
-		fmt.Printf(" ID: %s\n Name: %s\n Interface: %s\n Enabled: %v\n Color: %s\n",
-			groupRes.ID.String(), groupRes.Name, groupRes.Interface, groupRes.Enable, groupRes.Color)
-		return nil
+		return printItem(groupView, *groupRes, func() {
+			fmt.Println("Group created successfully")
+			printGroupDetails(groupRes)
+		})
 	},
 }
 
@@ -118,6 +122,8 @@ var updateGroupCmd = &cobra.Command{
 	Short:   "Update an existing group",
 	Long: `Updates an existing group by sending a PUT request to /api/v1/groups/{groupID}. 
 You must specify the group ID and optionally new name, interface, color, etc. 
+The current group is fetched first and only the flags you set are changed.
+Use --dry-run to print the resulting changes without applying them.
 Example:
     magitrickle group update <GROUP_ID> --name=NewName --enable=false --save
 `,
@@ -125,47 +131,56 @@ Example:
 		if len(args) < 1 {
 			return errors.New("please provide the group ID as an argument, e.g. 'magitrickle group update <GROUP_ID>'")
 		}
-		groupID := args[0]
+		c := newClient()
+		groupID, err := resolveGroupID(cmd.Context(), c, args[0])
+		if err != nil {
+			return err
+		}
 
-		name, _ := cmd.Flags().GetString("name")
-		iface, _ := cmd.Flags().GetString("interface")
-		enable, _ := cmd.Flags().GetBool("enable")
-		colorStr, _ := cmd.Flags().GetString("color")
+		current, err := c.Groups().Get(cmd.Context(), groupID, false)
+		if err != nil {
+			return err
+		}
 
+		// Rules are left nil so the server keeps them untouched.
 		reqBody := types.GroupReq{
-			Name:      name,
-			Interface: iface,
-			Color:     colorStr,
-			Enable:    &enable,
+			Name:      current.Name,
+			Interface: current.Interface,
+			Color:     current.Color,
+			Enable:    &current.Enable,
 		}
 
-		saveFlag, _ := cmd.Flags().GetBool("save")
-		var urlBuilder strings.Builder
-		urlBuilder.WriteString("/api/v1/groups/")
-		urlBuilder.WriteString(groupID)
-		if saveFlag {
-			urlBuilder.WriteString("?save=true")
-		}
+		var changes []fieldChange
+		applyStringFlag(cmd, "name", &reqBody.Name, &changes)
+		applyStringFlag(cmd, "interface", &reqBody.Interface, &changes)
+		applyStringFlag(cmd, "color", &reqBody.Color, &changes)
+		applyBoolFlag(cmd, "enable", reqBody.Enable, &changes)
 
-		resp, err := doUnixJSON(http.MethodPut, urlBuilder.String(), reqBody)
-		if err != nil {
-			return err
+		if len(changes) == 0 {
+			fmt.Printf("No changes for group %s\n", groupID)
+			return nil
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			return parseAPIError(resp)
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			fmt.Printf("Group %s would be updated (dry run):\n", groupID)
+			printFieldChanges(changes)
+			return nil
 		}
 
-		var groupRes types.GroupRes
-		if err := json.NewDecoder(resp.Body).Decode(&groupRes); err != nil {
-			return fmt.Errorf("failed to decode updated GroupRes: %w", err)
+		saveFlag, _ := cmd.Flags().GetBool("save")
+
+		snap := newSnapshot(cmd, args)
+		snap.add(*current)
+
+		groupRes, err := c.Groups().Update(cmd.Context(), groupID, reqBody, saveFlag)
+		if err != nil {
+			return err
 		}
+		snap.save()
 
-		fmt.Println("Group updated successfully")
-		fmt.Printf(" ID: %s\n Name: %s\n Interface: %s\n Enabled: %v\n Color: %s\n",
-			groupRes.ID.String(), groupRes.Name, groupRes.Interface, groupRes.Enable, groupRes.Color)
-		return nil
+		return printItem(groupView, *groupRes, func() {
+			fmt.Println("Group updated successfully")
+			printGroupDetails(groupRes)
+		})
 	},
 }
 
@@ -181,25 +196,23 @@ If --save is specified, the server will persist configuration changes.`,
 		if len(args) < 1 {
 			return errors.New("please provide the group ID to delete, e.g. 'magitrickle group delete <GROUP_ID>'")
 		}
-		groupID := args[0]
+		c := newClient()
+		groupID, err := resolveGroupID(cmd.Context(), c, args[0])
+		if err != nil {
+			return err
+		}
 
 		saveFlag, _ := cmd.Flags().GetBool("save")
-		var urlBuilder strings.Builder
-		urlBuilder.WriteString("/api/v1/groups/")
-		urlBuilder.WriteString(groupID)
-		if saveFlag {
-			urlBuilder.WriteString("?save=true")
-		}
 
-		resp, err := doUnixRequest(http.MethodDelete, urlBuilder.String(), nil)
-		if err != nil {
+		snap := newSnapshot(cmd, args)
+		if err := snap.capture(cmd.Context(), c, groupID); err != nil {
 			return err
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			return parseAPIError(resp)
+		if err := c.Groups().Delete(cmd.Context(), groupID, saveFlag); err != nil {
+			return err
 		}
+		snap.save()
 
 		fmt.Println("Group deleted successfully")
 		return nil
@@ -218,12 +231,17 @@ func init() {
 	createGroupCmd.Flags().String("interface", "br0", "Network interface for the group")
 	createGroupCmd.Flags().Bool("enable", true, "Enable the group upon creation")
 	createGroupCmd.Flags().String("color", "#ffffff", "Color hex code for the group")
+	_ = createGroupCmd.RegisterFlagCompletionFunc("interface", completeInterfaces)
 
 	updateGroupCmd.Flags().String("name", "", "New name for the group")
 	updateGroupCmd.Flags().String("interface", "", "New interface for the group")
 	updateGroupCmd.Flags().Bool("enable", true, "Enable/disable the group")
 	updateGroupCmd.Flags().String("color", "", "Color hex code for the group")
 	updateGroupCmd.Flags().Bool("save", false, "Save config changes (append ?save=true)")
+	updateGroupCmd.Flags().Bool("dry-run", false, "Only print the changes that would be made")
+	_ = updateGroupCmd.RegisterFlagCompletionFunc("interface", completeInterfaces)
+	updateGroupCmd.ValidArgsFunction = groupArgCompletion
 
 	deleteGroupCmd.Flags().Bool("save", false, "Save config changes (append ?save=true)")
+	deleteGroupCmd.ValidArgsFunction = groupArgCompletion
 }
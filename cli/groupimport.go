@@ -0,0 +1,202 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+
+	"magitrickle-cli/policy"
+	"magitrickle-cli/ruleset"
+
+	"github.com/spf13/cobra"
+)
+
+var importGroupsCmd = &cobra.Command{
+	Use:   "import [FILE]",
+	Short: "Create groups and rules from a dnsmasq ipset/nftset config",
+	Long: `Reads a dnsmasq config from FILE (or stdin) and turns every set of its
+ipset= and nftset= lines into a group of the same name:
+
+    ipset=/example.com/example.org/vpn
+    nftset=/example.net/4#inet#fw#vpn
+
+Each domain becomes a rule of the group (--type, namespace by default, as
+dnsmasq also matches subdomains). Existing groups are matched by name and
+keep their interface; missing groups are created with --interface. Use
+--map to import a set into a group with a different name. Lines that cannot
+be translated and rules that fail validation are reported.
+Example:
+    magitrickle group import /etc/dnsmasq.d/vpn.conf --interface=nwg0 --map vpn=VPN --dry-run
+`,
+	Args: cobra.MaximumNArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		formatName, _ := cmd.Flags().GetString("format")
+		iface, _ := cmd.Flags().GetString("interface")
+		domainType, _ := cmd.Flags().GetString("type")
+		setMap, _ := cmd.Flags().GetStringToString("map")
+		replace, _ := cmd.Flags().GetBool("replace")
+		force, _ := cmd.Flags().GetBool("force")
+		saveFlag, _ := cmd.Flags().GetBool("save")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+		noValidate, _ := cmd.Flags().GetBool("no-validate")
+
+		if formatName != "dnsmasq" {
+			return fmt.Errorf("unknown format %q (want dnsmasq)", formatName)
+		}
+		if domainType != ruleset.TypeNamespace && domainType != ruleset.TypeDomain {
+			return fmt.Errorf("--type must be %s or %s", ruleset.TypeNamespace, ruleset.TypeDomain)
+		}
+
+		filePath := "-"
+		if len(args) > 0 {
+			filePath = args[0]
+		}
+		r, err := openInput(filePath)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+		res, err := ruleset.ParseDnsmasq(r, ruleset.Options{DomainType: domainType})
+		if err != nil {
+			return fmt.Errorf("%s: %w", filePath, err)
+		}
+		if !noValidate {
+			for i := range res.Sets {
+				setRes := &ruleset.Result{Rules: res.Sets[i].Rules}
+				checkImported(setRes)
+				res.Sets[i].Rules = setRes.Rules
+				res.Issues = append(res.Issues, setRes.Issues...)
+			}
+		}
+		printIssues(res.Issues)
+		if len(res.Sets) == 0 {
+			return errors.New("no ipset or nftset lines found")
+		}
+
+		c := newClient()
+		live, err := c.Groups().List(cmd.Context(), true)
+		if err != nil {
+			return err
+		}
+
+		// Several sets may be mapped to one group, e.g. the IPv4 and IPv6
+		// sets of nftset lines.
+		var names []string
+		rulesByName := make(map[string][]types.RuleReq)
+		for _, set := range res.Sets {
+			name := set.Name
+			if mapped, ok := setMap[name]; ok {
+				name = mapped
+			}
+			if len(set.Rules) == 0 {
+				continue
+			}
+			if _, ok := rulesByName[name]; !ok {
+				names = append(names, name)
+			}
+			rulesByName[name] = append(rulesByName[name], set.Rules...)
+		}
+
+		doc := &policy.Document{}
+		for _, name := range names {
+			group, err := groupForSet(live, name, iface, rulesByName[name], replace, force)
+			if err != nil {
+				return err
+			}
+			doc.Groups = append(doc.Groups, group)
+		}
+
+		plan, err := policy.NewPlan(doc, live, false)
+		if err != nil {
+			return err
+		}
+		printPlan(plan)
+		if !plan.HasChanges() || dryRun {
+			return nil
+		}
+
+		err = plan.Apply(cmd.Context(), c, saveFlag)
+		snap := newSnapshot(cmd, args)
+		snap.addPlan(plan)
+		snap.save()
+		if err != nil {
+			return err
+		}
+		fmt.Println("Sets imported successfully")
+		return nil
+	},
+}
+
+// groupForSet describes the group a set is imported into: the live group
+// with that name plus the set's rules, or a new group on iface.
+func groupForSet(live []types.GroupRes, name, iface string, rules []types.RuleReq, replace, force bool) (policy.Group, error) {
+	var existing *types.GroupRes
+	for i := range live {
+		if live[i].Name != name {
+			continue
+		}
+		if existing != nil {
+			return policy.Group{}, fmt.Errorf("several groups are named %q, use --map to pick another name", name)
+		}
+		existing = &live[i]
+	}
+
+	if existing == nil {
+		if iface == "" {
+			return policy.Group{}, fmt.Errorf("group %q does not exist, --interface is required to create it", name)
+		}
+		return policy.Group{Name: name, Interface: iface, Rules: policyRules(rules)}, nil
+	}
+
+	var current []types.RuleRes
+	if existing.Rules != nil {
+		current = *existing.Rules
+	}
+	merged, stats := mergeRules(current, rules, replace)
+	if err := checkReplace(name, len(current), stats, force); err != nil {
+		return policy.Group{}, err
+	}
+	enable := existing.Enable
+	return policy.Group{
+		ID:        existing.ID.String(),
+		Name:      existing.Name,
+		Interface: existing.Interface,
+		Color:     existing.Color,
+		Enable:    &enable,
+		Rules:     policyRules(merged),
+	}, nil
+}
+
+// policyRules converts rule requests, keeping their IDs if set.
+func policyRules(reqs []types.RuleReq) *[]policy.Rule {
+	rules := make([]policy.Rule, 0, len(reqs))
+	for _, r := range reqs {
+		enable := r.Enable
+		rule := policy.Rule{Name: r.Name, Type: r.Type, Rule: r.Rule, Enable: &enable}
+		if r.ID != nil {
+			rule.ID = r.ID.String()
+		}
+		rules = append(rules, rule)
+	}
+	return &rules
+}
+
+func init() {
+	groupCmd.AddCommand(importGroupsCmd)
+
+	importGroupsCmd.Flags().String("format", "dnsmasq", "Input format")
+	importGroupsCmd.Flags().String("interface", "", "Interface for groups that have to be created")
+	importGroupsCmd.Flags().String("type", ruleset.TypeNamespace, "Rule type for domains (namespace or domain)")
+	importGroupsCmd.Flags().StringToString("map", nil, "Import set into group, as SET=GROUP (repeatable)")
+	importGroupsCmd.Flags().Bool("replace", false, "Replace the rules of existing groups instead of appending")
+	importGroupsCmd.Flags().Bool("force", false, "Allow --replace to remove all rules of a group")
+	importGroupsCmd.Flags().Bool("save", false, "Save config after importing")
+	importGroupsCmd.Flags().Bool("dry-run", false, "Only print the planned changes")
+	importGroupsCmd.Flags().Bool("no-validate", false, "Send the rules without checking them first")
+	_ = importGroupsCmd.RegisterFlagCompletionFunc("format", cobra.FixedCompletions(
+		[]string{"dnsmasq"}, cobra.ShellCompDirectiveNoFileComp))
+	_ = importGroupsCmd.RegisterFlagCompletionFunc("interface", completeInterfaces)
+	_ = importGroupsCmd.RegisterFlagCompletionFunc("type", cobra.FixedCompletions(
+		[]string{ruleset.TypeNamespace, ruleset.TypeDomain}, cobra.ShellCompDirectiveNoFileComp))
+}
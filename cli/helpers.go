@@ -1,26 +1,103 @@
 package cli
 
 import (
-	"encoding/json"
-	"fmt"
-	"io"
-	"net/http"
+	"errors"
+	"os"
+	"time"
 
-	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+	"magitrickle-cli/client"
 )
 
-func parseAPIError(resp *http.Response) error {
-	defer resp.Body.Close()
+// globalFlags holds the values of rootCmd persistent flags.
+var globalFlags struct {
+	config             string
+	context            string
+	output             string
+	socket             string
+	server             string
+	token              string
+	caCert             string
+	clientCert         string
+	clientKey          string
+	insecureSkipVerify bool
+	verbose            int
+	traceFile          string
+	retries            int
+	retryDelay         time.Duration
+}
+
+// clientOpts is filled by resolveClientOptions before any command runs.
+var clientOpts client.Options
+
+// requestTrace records the requests for --trace-file; Execute writes it.
+var requestTrace *client.Trace
 
-	var errRes types.ErrorRes
-	body, err := io.ReadAll(resp.Body)
+// resolveClientOptions merges connection settings with the precedence
+// flag > environment > active context of the config file > built-in default. The socket and the
+// server are one setting: the most specific source that sets either wins.
+func resolveClientOptions() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return withClass(err, errSetup)
+	}
+	conn, err := cfg.activeConnection()
 	if err != nil {
-		return fmt.Errorf("request failed with status code %d (and body read error: %v)", resp.StatusCode, err)
+		return withClass(err, errSetup)
 	}
 
-	if json.Unmarshal(body, &errRes) == nil && errRes.Error != "" {
-		return fmt.Errorf("api error %d: %s", resp.StatusCode, errRes.Error)
+	sources := []struct{ socket, server string }{
+		{globalFlags.socket, globalFlags.server},
+		{os.Getenv(envSocket), os.Getenv(envServer)},
+		{conn.Socket, conn.Server},
 	}
+	var opts client.Options
+	for _, src := range sources {
+		if src.socket != "" && src.server != "" {
+			return errors.New("socket and server are mutually exclusive, specify only one of them")
+		}
+		if src.socket != "" || src.server != "" {
+			opts.SocketPath, opts.Server = src.socket, src.server
+			break
+		}
+	}
+
+	opts.Token = firstNonEmpty(globalFlags.token, os.Getenv(envToken), conn.Token)
 
-	return fmt.Errorf("request failed with status code %d", resp.StatusCode)
+	tlsFiles := client.TLSFiles{
+		CAFile:             firstNonEmpty(globalFlags.caCert, conn.CACert),
+		CertFile:           firstNonEmpty(globalFlags.clientCert, conn.ClientCert),
+		KeyFile:            firstNonEmpty(globalFlags.clientKey, conn.ClientKey),
+		InsecureSkipVerify: globalFlags.insecureSkipVerify || conn.insecureSkipVerify(),
+	}
+	if !tlsFiles.IsZero() {
+		opts.TLSConfig, err = tlsFiles.TLSConfig()
+		if err != nil {
+			return withClass(err, errSetup)
+		}
+	}
+
+	opts.Verbosity = globalFlags.verbose
+	opts.Retries = globalFlags.retries
+	opts.RetryDelay = globalFlags.retryDelay
+	if globalFlags.traceFile != "" {
+		requestTrace = &client.Trace{}
+		opts.Trace = requestTrace
+	}
+
+	clientOpts = opts
+	return nil
+}
+
+// newClient builds an API client for the current invocation.
+func newClient() *client.Client {
+	return client.New(clientOpts)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, v := range values {
+		if v != "" {
+			return v
+		}
+	}
+	return ""
 }
@@ -0,0 +1,405 @@
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+
+	"magitrickle-cli/client"
+	"magitrickle-cli/policy"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+const (
+	envHistoryDir = "MAGITRICKLE_HISTORY_DIR"
+	// historyLimit is the number of entries kept; older ones are removed.
+	historyLimit = 50
+)
+
+// historyEntry is the state of the groups touched by one command, taken
+// before the command changed them.
+type historyEntry struct {
+	N       int            `json:"n"`
+	Time    time.Time      `json:"time"`
+	Command string         `json:"command"`
+	Source  string         `json:"source"`
+	Groups  []historyGroup `json:"groups"`
+}
+
+// historyGroup is one group as it was before the change. Before is nil if
+// the group did not exist yet; its rules are nil if they were not touched.
+type historyGroup struct {
+	ID     string          `json:"id"`
+	Before *types.GroupRes `json:"before"`
+}
+
+var historyView = resourceView[historyEntry]{
+	columns: []tableColumn[historyEntry]{
+		{header: "N", value: func(e historyEntry) string { return strconv.Itoa(e.N) }},
+		{header: "TIME", value: func(e historyEntry) string { return e.Time.Local().Format("2006-01-02 15:04:05") }},
+		{header: "COMMAND", value: func(e historyEntry) string { return e.Command }},
+		{header: "SOURCE", wide: true, value: func(e historyEntry) string { return e.Source }},
+	},
+	name: func(e historyEntry) string { return strconv.Itoa(e.N) },
+}
+
+// snapshot collects the state of groups before a mutating command. It is
+// written to the history once the command has changed something.
+type snapshot struct {
+	entry historyEntry
+}
+
+func newSnapshot(cmd *cobra.Command, args []string) *snapshot {
+	parts := append([]string{cmd.CommandPath()}, args...)
+	// Global flags are left out, they may carry a token.
+	cmd.Flags().Visit(func(f *pflag.Flag) {
+		if cmd.InheritedFlags().Lookup(f.Name) == nil {
+			parts = append(parts, "--"+f.Name+"="+f.Value.String())
+		}
+	})
+	return &snapshot{entry: historyEntry{
+		Command: strings.Join(parts, " "),
+		Source:  currentSource(),
+	}}
+}
+
+// add records an existing group. Its rules are restored on rollback only if
+// g.Rules is set.
+func (s *snapshot) add(g types.GroupRes) {
+	s.entry.Groups = append(s.entry.Groups, historyGroup{ID: g.ID.String(), Before: &g})
+}
+
+// capture fetches a group with its rules and records it.
+func (s *snapshot) capture(ctx context.Context, c *client.Client, groupID string) error {
+	g, err := c.Groups().Get(ctx, groupID, true)
+	if err != nil {
+		return err
+	}
+	s.add(*g)
+	return nil
+}
+
+// created records a group that did not exist before the command.
+func (s *snapshot) created(id types.ID) {
+	s.entry.Groups = append(s.entry.Groups, historyGroup{ID: id.String()})
+}
+
+// addPlan records the groups touched by an applied plan. It is also used
+// after a failed Apply: groups that were not changed yet are recorded in
+// their current state, which makes rolling them back a no-op.
+func (s *snapshot) addPlan(plan *policy.Plan) {
+	for _, g := range plan.Groups {
+		switch {
+		case g.Action == policy.ActionUnchanged:
+		case g.Live != nil:
+			s.add(*g.Live)
+		case g.Result != nil:
+			s.created(g.Result.ID)
+		}
+	}
+}
+
+// save writes the snapshot to the history. Failing to do so does not fail
+// the command, which has already been executed.
+func (s *snapshot) save() {
+	if err := writeHistoryEntry(&s.entry); err != nil {
+		fmt.Fprintf(os.Stderr, "Warning: failed to record history: %v\n", err)
+	}
+}
+
+// currentSource describes the API target, so that entries are not rolled
+// back against another router by accident.
+func currentSource() string {
+	return describeConnection(Connection{Socket: clientOpts.SocketPath, Server: clientOpts.Server})
+}
+
+// historyDir is $MAGITRICKLE_HISTORY_DIR or
+// $XDG_STATE_HOME/magitrickle/history.
+func historyDir() (string, error) {
+	if dir := os.Getenv(envHistoryDir); dir != "" {
+		return dir, nil
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate history directory: %w", err)
+	}
+	return filepath.Join(dir, "history"), nil
+}
+
+// stateDir is $XDG_STATE_HOME/magitrickle, by default
+// ~/.local/state/magitrickle.
+func stateDir() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "magitrickle"), nil
+}
+
+// loadHistory returns all entries, newest first.
+func loadHistory() ([]historyEntry, error) {
+	dir, err := historyDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := os.ReadDir(dir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read history: %w", err)
+	}
+
+	var entries []historyEntry
+	for _, f := range files {
+		n, ok := historyFileNumber(f.Name())
+		if !ok {
+			continue
+		}
+		content, err := os.ReadFile(filepath.Join(dir, f.Name()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read history: %w", err)
+		}
+		var e historyEntry
+		if err := json.Unmarshal(content, &e); err != nil {
+			return nil, fmt.Errorf("failed to parse history entry %s: %w", f.Name(), err)
+		}
+		e.N = n
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].N > entries[j].N })
+	return entries, nil
+}
+
+func loadHistoryEntry(ref string) (*historyEntry, error) {
+	n, err := strconv.Atoi(ref)
+	if err != nil || n <= 0 {
+		return nil, fmt.Errorf("invalid history entry %q, expected a number from 'magitrickle history list'", ref)
+	}
+	entries, err := loadHistory()
+	if err != nil {
+		return nil, err
+	}
+	for i := range entries {
+		if entries[i].N == n {
+			return &entries[i], nil
+		}
+	}
+	return nil, withClass(fmt.Errorf("history entry %d not found", n), client.ErrNotFound)
+}
+
+// writeHistoryEntry stores e under the next free number and removes the
+// oldest entries beyond historyLimit.
+func writeHistoryEntry(e *historyEntry) error {
+	if len(e.Groups) == 0 {
+		return nil
+	}
+	entries, err := loadHistory()
+	if err != nil {
+		return err
+	}
+	dir, err := historyDir()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return err
+	}
+
+	e.N = 1
+	if len(entries) > 0 {
+		e.N = entries[0].N + 1
+	}
+	e.Time = time.Now().UTC().Truncate(time.Second)
+
+	content, err := json.MarshalIndent(e, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, historyFileName(e.N)), content, 0o600); err != nil {
+		return err
+	}
+
+	for i := historyLimit - 1; i < len(entries); i++ {
+		_ = os.Remove(filepath.Join(dir, historyFileName(entries[i].N)))
+	}
+	return nil
+}
+
+func historyFileName(n int) string {
+	return fmt.Sprintf("%06d.json", n)
+}
+
+func historyFileNumber(name string) (int, bool) {
+	base, ok := strings.CutSuffix(name, ".json")
+	if !ok {
+		return 0, false
+	}
+	n, err := strconv.Atoi(base)
+	return n, err == nil && n > 0
+}
+
+var historyCmd = &cobra.Command{
+	Use:   "history",
+	Short: "Show and roll back earlier changes",
+	Long: `Every create, update, delete and replace of groups and rules first stores
+the affected groups in a local history ($XDG_STATE_HOME/magitrickle/history,
+or $MAGITRICKLE_HISTORY_DIR). "history rollback" restores that earlier state
+through the API. The last ` + strconv.Itoa(historyLimit) + ` entries are kept.`,
+}
+
+var listHistoryCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List recorded changes, newest first",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entries, err := loadHistory()
+		if err != nil {
+			return err
+		}
+
+		return printList(historyView, entries, func() {
+			if len(entries) == 0 {
+				fmt.Println("No history recorded.")
+				return
+			}
+			_ = writeTable(os.Stdout, historyView, entries, false)
+		})
+	},
+}
+
+var showHistoryCmd = &cobra.Command{
+	Use:   "show <N>",
+	Short: "Show the state recorded before a change",
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		entry, err := loadHistoryEntry(args[0])
+		if err != nil {
+			return err
+		}
+
+		return printItem(historyView, *entry, func() {
+			fmt.Printf("Entry %d, %s\n Command: %s\n Source: %s\n",
+				entry.N, entry.Time.Local().Format(time.RFC3339), entry.Command, entry.Source)
+			fmt.Println("State before the change:")
+			for _, g := range entry.Groups {
+				if g.Before == nil {
+					fmt.Printf(" - Group %s did not exist\n", g.ID)
+					continue
+				}
+				fmt.Printf(" - ID: %s\n   Name: %s\n   Interface: %s\n   Enabled: %v\n   Color: %s\n",
+					g.ID, g.Before.Name, g.Before.Interface, g.Before.Enable, g.Before.Color)
+				if g.Before.Rules != nil {
+					fmt.Println("   Rules:")
+					for _, r := range *g.Before.Rules {
+						fmt.Printf("     * %s (%s) => %s [enabled: %v]\n",
+							r.Name, r.Type, r.Rule, r.Enable)
+					}
+				}
+			}
+		})
+	},
+}
+
+var rollbackHistoryCmd = &cobra.Command{
+	Use:   "rollback <N>",
+	Short: "Restore the state from before a change",
+	Long: `Restores the groups touched by history entry N to the state they had before
+that change: groups are updated or recreated (with their IDs), and groups
+created by the change are deleted. Rules are restored for commands that
+changed them; deleted rules are recreated with new IDs, as the API does not
+allow choosing them. Other groups are left alone.
+
+The rollback itself is recorded in the history and can be rolled back too.
+Example:
+    magitrickle history list
+    magitrickle history rollback 12 --dry-run
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+		saveFlag, _ := cmd.Flags().GetBool("save")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		entry, err := loadHistoryEntry(args[0])
+		if err != nil {
+			return err
+		}
+		if source := currentSource(); entry.Source != source && !force {
+			return fmt.Errorf("history entry %d was recorded for %s, not %s (use --force to roll back anyway)",
+				entry.N, entry.Source, source)
+		}
+
+		c := newClient()
+		live, err := c.Groups().List(cmd.Context(), true)
+		if err != nil {
+			return err
+		}
+		liveByID := make(map[string]*types.GroupRes, len(live))
+		for i := range live {
+			liveByID[live[i].ID.String()] = &live[i]
+		}
+
+		var restore []types.GroupRes
+		var remove []*types.GroupRes
+		for _, g := range entry.Groups {
+			current := liveByID[g.ID]
+			switch {
+			case g.Before != nil:
+				restore = append(restore, *g.Before)
+			case current != nil:
+				remove = append(remove, current)
+			}
+		}
+
+		plan, err := policy.NewPlan(policy.FromGroups(restore), live, false)
+		if err != nil {
+			return err
+		}
+		for _, g := range remove {
+			plan.Groups = append(plan.Groups, policy.GroupChange{Action: policy.ActionDelete, Live: g})
+		}
+
+		printPlan(plan)
+		if !plan.HasChanges() || dryRun {
+			return nil
+		}
+
+		err = plan.Apply(cmd.Context(), c, saveFlag)
+		snap := newSnapshot(cmd, args)
+		snap.addPlan(plan)
+		snap.save()
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Rolled back to the state before entry %d\n", entry.N)
+		return nil
+	},
+}
+
+func init() {
+	historyCmd.AddCommand(listHistoryCmd)
+	historyCmd.AddCommand(showHistoryCmd)
+	historyCmd.AddCommand(rollbackHistoryCmd)
+
+	rollbackHistoryCmd.Flags().Bool("force", false, "Roll back even if the entry was recorded for another server")
+	rollbackHistoryCmd.Flags().Bool("save", false, "Save config after rolling back")
+	rollbackHistoryCmd.Flags().Bool("dry-run", false, "Only print the planned changes")
+}
@@ -0,0 +1,263 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// executeJSONPath evaluates a kubectl-style JSONPath template against data
+// produced by toGeneric. Supported syntax: {.field}, {.a.b[0]}, {[*]},
+// {..field}, {['field']}, {range <expr>}...{end} and {"literal\n"}.
+// Multiple results of one expression are separated by spaces.
+func executeJSONPath(w io.Writer, tmpl string, data interface{}) error {
+	nodes, err := parseJSONPathTemplate(tmpl)
+	if err != nil {
+		return fmt.Errorf("invalid jsonpath: %w", err)
+	}
+	if err := evalJSONPathNodes(w, nodes, data); err != nil {
+		return err
+	}
+	_, err = fmt.Fprintln(w)
+	return err
+}
+
+type jsonPathNode struct {
+	text string
+	// expr is set for {...} expressions; body for {range}.
+	expr    string
+	isRange bool
+	body    []jsonPathNode
+}
+
+func parseJSONPathTemplate(tmpl string) ([]jsonPathNode, error) {
+	root := []jsonPathNode{}
+	stack := []*[]jsonPathNode{&root}
+	var ranges []*jsonPathNode
+
+	for len(tmpl) > 0 {
+		open := strings.IndexByte(tmpl, '{')
+		if open < 0 {
+			*stack[len(stack)-1] = append(*stack[len(stack)-1], jsonPathNode{text: tmpl})
+			break
+		}
+		if open > 0 {
+			*stack[len(stack)-1] = append(*stack[len(stack)-1], jsonPathNode{text: tmpl[:open]})
+		}
+		end := strings.IndexByte(tmpl[open:], '}')
+		if end < 0 {
+			return nil, errors.New("unclosed {")
+		}
+		expr := strings.TrimSpace(tmpl[open+1 : open+end])
+		tmpl = tmpl[open+end+1:]
+
+		cur := stack[len(stack)-1]
+		switch {
+		case expr == "end":
+			if len(ranges) == 0 {
+				return nil, errors.New("{end} without {range}")
+			}
+			ranges = ranges[:len(ranges)-1]
+			stack = stack[:len(stack)-1]
+		case expr == "range" || strings.HasPrefix(expr, "range "):
+			rangeExpr := strings.TrimSpace(strings.TrimPrefix(expr, "range"))
+			if rangeExpr == "" {
+				return nil, errors.New("{range} without an expression")
+			}
+			*cur = append(*cur, jsonPathNode{expr: rangeExpr, isRange: true})
+			node := &(*cur)[len(*cur)-1]
+			ranges = append(ranges, node)
+			stack = append(stack, &node.body)
+		case strings.HasPrefix(expr, `"`):
+			text, err := strconv.Unquote(expr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid string literal %s", expr)
+			}
+			*cur = append(*cur, jsonPathNode{text: text})
+		default:
+			*cur = append(*cur, jsonPathNode{expr: expr})
+		}
+	}
+	if len(ranges) > 0 {
+		return nil, errors.New("{range} without {end}")
+	}
+	return root, nil
+}
+
+func evalJSONPathNodes(w io.Writer, nodes []jsonPathNode, data interface{}) error {
+	for _, node := range nodes {
+		if node.expr == "" {
+			if _, err := io.WriteString(w, node.text); err != nil {
+				return err
+			}
+			continue
+		}
+
+		values, err := evalJSONPathExpr(node.expr, data)
+		if err != nil {
+			return err
+		}
+		if node.isRange {
+			for _, v := range values {
+				if err := evalJSONPathNodes(w, node.body, v); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+		for i, v := range values {
+			if i > 0 {
+				if _, err := io.WriteString(w, " "); err != nil {
+					return err
+				}
+			}
+			if _, err := io.WriteString(w, jsonPathString(v)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func evalJSONPathExpr(expr string, data interface{}) ([]interface{}, error) {
+	expr = strings.TrimPrefix(expr, "$")
+	values := []interface{}{data}
+
+	for len(expr) > 0 {
+		switch {
+		case strings.HasPrefix(expr, ".."):
+			expr = expr[2:]
+			name, rest := splitJSONPathField(expr)
+			expr = rest
+			var next []interface{}
+			for _, v := range values {
+				next = append(next, collectJSONPathField(v, name)...)
+			}
+			values = next
+		case strings.HasPrefix(expr, "."):
+			expr = expr[1:]
+			name, rest := splitJSONPathField(expr)
+			expr = rest
+			if name == "" {
+				continue
+			}
+			values = selectJSONPathField(values, name)
+		case strings.HasPrefix(expr, "["):
+			end := strings.IndexByte(expr, ']')
+			if end < 0 {
+				return nil, fmt.Errorf("invalid jsonpath: unclosed [ in %q", expr)
+			}
+			sel := strings.TrimSpace(expr[1:end])
+			expr = expr[end+1:]
+
+			if len(sel) >= 2 && (sel[0] == '\'' || sel[0] == '"') && sel[len(sel)-1] == sel[0] {
+				values = selectJSONPathField(values, sel[1:len(sel)-1])
+				continue
+			}
+
+			var next []interface{}
+			for _, v := range values {
+				arr, ok := v.([]interface{})
+				if !ok {
+					continue
+				}
+				if sel == "*" {
+					next = append(next, arr...)
+					continue
+				}
+				idx, err := strconv.Atoi(sel)
+				if err != nil {
+					return nil, fmt.Errorf("invalid jsonpath: bad index %q", sel)
+				}
+				if idx < 0 {
+					idx += len(arr)
+				}
+				if idx >= 0 && idx < len(arr) {
+					next = append(next, arr[idx])
+				}
+			}
+			values = next
+		default:
+			return nil, fmt.Errorf("invalid jsonpath: unexpected %q", expr)
+		}
+	}
+	return values, nil
+}
+
+func splitJSONPathField(expr string) (name, rest string) {
+	i := strings.IndexAny(expr, ".[")
+	if i < 0 {
+		return expr, ""
+	}
+	return expr[:i], expr[i:]
+}
+
+func selectJSONPathField(values []interface{}, name string) []interface{} {
+	var next []interface{}
+	for _, v := range values {
+		switch t := v.(type) {
+		case map[string]interface{}:
+			if name == "*" {
+				for _, key := range sortedKeys(t) {
+					next = append(next, t[key])
+				}
+			} else if child, ok := t[name]; ok {
+				next = append(next, child)
+			}
+		case []interface{}:
+			if name == "*" {
+				next = append(next, t...)
+			}
+		}
+	}
+	return next
+}
+
+// collectJSONPathField implements recursive descent (..name).
+func collectJSONPathField(v interface{}, name string) []interface{} {
+	var found []interface{}
+	switch t := v.(type) {
+	case map[string]interface{}:
+		if child, ok := t[name]; ok {
+			found = append(found, child)
+		}
+		for _, key := range sortedKeys(t) {
+			found = append(found, collectJSONPathField(t[key], name)...)
+		}
+	case []interface{}:
+		for _, child := range t {
+			found = append(found, collectJSONPathField(child, name)...)
+		}
+	}
+	return found
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func jsonPathString(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case json.Number:
+		return t.String()
+	case nil:
+		return ""
+	default:
+		content, err := json.Marshal(t)
+		if err != nil {
+			return fmt.Sprint(t)
+		}
+		return string(content)
+	}
+}
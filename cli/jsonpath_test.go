@@ -0,0 +1,81 @@
+package cli
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestExecuteJSONPath(t *testing.T) {
+	data, err := toGeneric(map[string]interface{}{
+		"groups": []map[string]interface{}{
+			{"name": "VPN", "enable": true, "rules": []map[string]interface{}{
+				{"rule": "example.com", "id": 1},
+				{"rule": "example.org", "id": 2},
+			}},
+			{"name": "Ads", "enable": false, "rules": []map[string]interface{}{
+				{"rule": "ads.example", "id": 3},
+			}},
+		},
+		"weird.key": "dot",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		tmpl    string
+		want    string
+		wantErr string
+	}{
+		{tmpl: "{.groups[0].name}", want: "VPN"},
+		{tmpl: "{$.groups[1].enable}", want: "false"},
+		{tmpl: "{.groups[-1].name}", want: "Ads"},
+		{tmpl: "{.groups[5].name}", want: ""},
+		{tmpl: "{.groups[-3].name}", want: ""},
+		{tmpl: "{.groups[*].name}", want: "VPN Ads"},
+		{tmpl: "{.groups.*.name}", want: "VPN Ads"},
+		{tmpl: "{.groups[0].rules[*].id}", want: "1 2"},
+		{tmpl: "{..rule}", want: "example.com example.org ads.example"},
+		{tmpl: "{.groups[1]..id}", want: "3"},
+		{tmpl: "{['weird.key']}", want: "dot"},
+		{tmpl: `{["groups"][0]["name"]}`, want: "VPN"},
+		{tmpl: "{.groups[1].rules[0]}", want: `{"id":3,"rule":"ads.example"}`},
+		{tmpl: "{.missing}", want: ""},
+		{tmpl: "name={.groups[0].name};", want: "name=VPN;"},
+		{
+			tmpl: `{range .groups[*]}{.name}{"\t"}{range .rules[*]}{.rule},{end}{"\n"}{end}`,
+			want: "VPN\texample.com,example.org,\nAds\tads.example,\n",
+		},
+		{tmpl: "{range .missing}x{end}", want: ""},
+		{tmpl: `{"aé"}`, want: "aé"},
+
+		{tmpl: "{.groups", wantErr: "unclosed {"},
+		{tmpl: "{end}", wantErr: "{end} without {range}"},
+		{tmpl: "{range .groups[*]}{.name}", wantErr: "{range} without {end}"},
+		{tmpl: `{"unterminated}`, wantErr: "invalid string literal"},
+		{tmpl: `{"}"}`, wantErr: "invalid string literal"},
+		{tmpl: "{.groups[0}", wantErr: "unclosed ["},
+		{tmpl: "{.groups[x]}", wantErr: "bad index"},
+		{tmpl: "{.groups[]}", wantErr: "bad index"},
+		{tmpl: "{.groups[']}", wantErr: "bad index"},
+		{tmpl: "{groups}", wantErr: "unexpected"},
+		{tmpl: "{range}{end}", wantErr: "{range} without an expression"},
+	}
+	for _, tt := range tests {
+		var b strings.Builder
+		err := executeJSONPath(&b, tt.tmpl, data)
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%s: err = %v, want %q", tt.tmpl, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.tmpl, err)
+			continue
+		}
+		if got := strings.TrimSuffix(b.String(), "\n"); got != tt.want {
+			t.Errorf("%s = %q, want %q", tt.tmpl, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package cli
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"net/url"
+	"os"
+	"strings"
+
+	"magitrickle-cli/matcher"
+	"magitrickle-cli/ruleset"
+
+	"github.com/spf13/cobra"
+)
+
+var matchView = resourceView[matcher.Match]{
+	columns: []tableColumn[matcher.Match]{
+		{header: "WINS", value: func(m matcher.Match) string {
+			if m.Wins {
+				return "*"
+			}
+			return ""
+		}},
+		{header: "GROUP", value: func(m matcher.Match) string { return m.Group }},
+		{header: "INTERFACE", value: func(m matcher.Match) string { return m.Interface }},
+		{header: "RULE ID", value: func(m matcher.Match) string { return m.Rule.ID.String() }},
+		{header: "TYPE", value: func(m matcher.Match) string { return m.Rule.Type }},
+		{header: "RULE", value: func(m matcher.Match) string { return m.Rule.Rule }},
+		{header: "STATE", value: matchState},
+	},
+	name: func(m matcher.Match) string { return m.Rule.ID.String() },
+}
+
+func matchState(m matcher.Match) string {
+	switch {
+	case !m.GroupEnabled:
+		return "group disabled"
+	case !m.Rule.Enable:
+		return "rule disabled"
+	}
+	return "active"
+}
+
+// parseMatchTarget accepts an IP address, a domain name or a URL.
+func parseMatchTarget(s string) (name string, addr netip.Addr, err error) {
+	if u, err := url.Parse(s); err == nil && u.Host != "" {
+		s = u.Hostname()
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(s, "[]")); err == nil {
+		return "", addr.Unmap(), nil
+	}
+	name, err = ruleset.NormalizeDomain(s)
+	return name, netip.Addr{}, err
+}
+
+var matchCmd = &cobra.Command{
+	Use:   "match <DOMAIN|IP>",
+	Short: "Show which rules and groups match a domain or IP",
+	Long: `Fetches all groups with their rules and evaluates them locally, like the
+daemon does: domain rules match the exact name, namespace rules the name and
+its subdomains, wildcard and regex rules the pattern (regexes are not
+anchored). IP addresses are matched against subnet and subnet6 rules.
+
+Every matching rule is listed with its group, interface and state. The
+daemon adds the resolved addresses to every enabled group with an enabled
+matching rule; the first of them in configuration order is marked with *.
+URLs are accepted and reduced to their host name.
+
+Exits with status 1 if no enabled rule matches.
+Example:
+    magitrickle match www.youtube.com
+    magitrickle match 192.0.2.10 -o json
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, addr, err := parseMatchTarget(args[0])
+		if err != nil {
+			return err
+		}
+
+		groups, err := newClient().Groups().List(cmd.Context(), true)
+		if err != nil {
+			return err
+		}
+		m := matcher.New(groups)
+		target := name
+		var matches []matcher.Match
+		if addr.IsValid() {
+			target = addr.String()
+			matches = m.IP(addr)
+		} else {
+			matches = m.Domain(name)
+		}
+
+		var winner *matcher.Match
+		for i := range matches {
+			if matches[i].Wins {
+				winner = &matches[i]
+			}
+		}
+		err = printList(matchView, matches, func() {
+			if len(matches) == 0 {
+				fmt.Printf("No rule matches %s\n", target)
+				return
+			}
+			_ = writeTable(os.Stdout, matchView, matches, false)
+			if winner != nil {
+				fmt.Printf("%s is routed by group %s (%s)\n", target, winner.Group, winner.Interface)
+			} else {
+				fmt.Printf("%s matches only disabled rules and is not routed\n", target)
+			}
+		})
+		if err != nil {
+			return err
+		}
+		if winner == nil {
+			cmd.SilenceErrors = true
+			return &exitError{code: 1, err: errors.New("no enabled rule matches")}
+		}
+		return nil
+	},
+}
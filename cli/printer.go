@@ -0,0 +1,199 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Output formats accepted by -o/--output. An empty format keeps the
+// human-readable text each command prints by default.
+const (
+	outputJSON     = "json"
+	outputYAML     = "yaml"
+	outputTable    = "table"
+	outputWide     = "wide"
+	outputName     = "name"
+	outputTemplate = "template="
+	outputJSONPath = "jsonpath="
+)
+
+// outputFormat holds the parsed value of -o/--output.
+type outputFormat struct {
+	kind string
+	// expr is the template or JSONPath expression.
+	expr string
+}
+
+func parseOutputFormat(s string) (outputFormat, error) {
+	switch s {
+	case "", outputJSON, outputYAML, outputTable, outputWide, outputName:
+		return outputFormat{kind: s}, nil
+	}
+	for _, prefix := range []string{outputTemplate, outputJSONPath} {
+		if strings.HasPrefix(s, prefix) {
+			expr := strings.TrimPrefix(s, prefix)
+			if expr == "" {
+				return outputFormat{}, fmt.Errorf("output format %q requires an expression", strings.TrimSuffix(prefix, "="))
+			}
+			return outputFormat{kind: prefix, expr: expr}, nil
+		}
+	}
+	return outputFormat{}, fmt.Errorf("unknown output format %q (want json, yaml, table, wide, name, template=... or jsonpath=...)", s)
+}
+
+// output is filled from the global flag before any command runs.
+var output outputFormat
+
+// tableColumn describes one column of table/wide output.
+type tableColumn[T any] struct {
+	header string
+	// wide columns are only shown with -o wide.
+	wide  bool
+	value func(T) string
+}
+
+// resourceView describes how a resource is rendered by the shared formats.
+type resourceView[T any] struct {
+	columns []tableColumn[T]
+	// name returns the identifier printed by -o name.
+	name func(T) string
+}
+
+// printList prints items in the selected output format. text is the
+// command's own human-readable output, used when no format is selected.
+func printList[T any](view resourceView[T], items []T, text func()) error {
+	if items == nil {
+		items = []T{}
+	}
+	return printResource(os.Stdout, view, items, items, text)
+}
+
+// printItem is printList for a single object.
+func printItem[T any](view resourceView[T], item T, text func()) error {
+	return printResource(os.Stdout, view, []T{item}, item, text)
+}
+
+func printResource[T any](w io.Writer, view resourceView[T], rows []T, data interface{}, text func()) error {
+	switch output.kind {
+	case "":
+		text()
+		return nil
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+	case outputYAML:
+		return writeYAML(w, data)
+	case outputTable, outputWide:
+		return writeTable(w, view, rows, output.kind == outputWide)
+	case outputName:
+		for _, row := range rows {
+			if _, err := fmt.Fprintln(w, view.name(row)); err != nil {
+				return err
+			}
+		}
+		return nil
+	case outputTemplate:
+		generic, err := toGeneric(data)
+		if err != nil {
+			return err
+		}
+		tmpl, err := template.New("output").Parse(output.expr)
+		if err != nil {
+			return fmt.Errorf("invalid template: %w", err)
+		}
+		return tmpl.Execute(w, generic)
+	case outputJSONPath:
+		generic, err := toGeneric(data)
+		if err != nil {
+			return err
+		}
+		return executeJSONPath(w, output.expr, generic)
+	}
+	return fmt.Errorf("unsupported output format %q", output.kind)
+}
+
+func writeTable[T any](w io.Writer, view resourceView[T], rows []T, wide bool) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 3, ' ', 0)
+
+	var columns []tableColumn[T]
+	for _, col := range view.columns {
+		if !col.wide || wide {
+			columns = append(columns, col)
+		}
+	}
+
+	headers := make([]string, len(columns))
+	for i, col := range columns {
+		headers[i] = col.header
+	}
+	fmt.Fprintln(tw, strings.Join(headers, "\t"))
+
+	for _, row := range rows {
+		values := make([]string, len(columns))
+		for i, col := range columns {
+			values[i] = col.value(row)
+		}
+		fmt.Fprintln(tw, strings.Join(values, "\t"))
+	}
+	return tw.Flush()
+}
+
+// toGeneric converts API types into plain maps and slices keyed by their
+// JSON names, so templates and YAML use the same field names as the API.
+func toGeneric(data interface{}) (interface{}, error) {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return nil, fmt.Errorf("json marshal fail: %w", err)
+	}
+	var generic interface{}
+	dec := json.NewDecoder(bytes.NewReader(content))
+	dec.UseNumber()
+	if err := dec.Decode(&generic); err != nil {
+		return nil, err
+	}
+	return generic, nil
+}
+
+// writeYAML converts data through JSON (keeping the API field names and
+// order) and prints it in block style.
+func writeYAML(w io.Writer, data interface{}) error {
+	content, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("json marshal fail: %w", err)
+	}
+	var node yaml.Node
+	if err := yaml.Unmarshal(content, &node); err != nil {
+		return err
+	}
+	resetYAMLStyle(&node)
+
+	enc := yaml.NewEncoder(w)
+	enc.SetIndent(2)
+	if err := enc.Encode(&node); err != nil {
+		return err
+	}
+	return enc.Close()
+}
+
+func resetYAMLStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		resetYAMLStyle(child)
+	}
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
@@ -0,0 +1,122 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"magitrickle-cli/client"
+)
+
+// refCandidate is an object a user reference may point to.
+type refCandidate struct {
+	id   string
+	name string
+}
+
+// minPrefixLen is the shortest ID prefix accepted, so that a typo does not
+// silently pick some object.
+const minPrefixLen = 4
+
+// resolveRef finds the single candidate matching ref. In order of priority
+// ref may be a full ID, an exact name, or a unique ID prefix of at least
+// minPrefixLen characters or case-insensitive name.
+func resolveRef(kind, ref string, candidates []refCandidate) (string, error) {
+	if ref == "" {
+		return "", withClass(fmt.Errorf("%s reference must not be empty", kind), errUsage)
+	}
+	for _, c := range candidates {
+		if c.id == ref {
+			return c.id, nil
+		}
+	}
+
+	var exact []refCandidate
+	for _, c := range candidates {
+		if c.name == ref {
+			exact = append(exact, c)
+		}
+	}
+	if len(exact) == 1 {
+		return exact[0].id, nil
+	}
+	if len(exact) > 1 {
+		return "", ambiguousRefError(kind, ref, exact)
+	}
+
+	lowerRef := strings.ToLower(ref)
+	var fuzzy []refCandidate
+	for _, c := range candidates {
+		prefix := len(ref) >= minPrefixLen && strings.HasPrefix(c.id, lowerRef)
+		if prefix || strings.EqualFold(c.name, ref) {
+			fuzzy = append(fuzzy, c)
+		}
+	}
+	switch len(fuzzy) {
+	case 0:
+		err := fmt.Errorf("%s %q not found", kind, ref)
+		if len(ref) < minPrefixLen {
+			err = fmt.Errorf("%w (ID prefixes need at least %d characters)", err, minPrefixLen)
+		}
+		return "", withClass(err, client.ErrNotFound)
+	case 1:
+		return fuzzy[0].id, nil
+	default:
+		return "", ambiguousRefError(kind, ref, fuzzy)
+	}
+}
+
+func ambiguousRefError(kind, ref string, matches []refCandidate) error {
+	sort.Slice(matches, func(i, j int) bool { return matches[i].id < matches[j].id })
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %q is ambiguous, candidates:", kind, ref)
+	for _, m := range matches {
+		fmt.Fprintf(&b, "\n  %s  %s", m.id, m.name)
+	}
+	return withClass(errors.New(b.String()), errUsage)
+}
+
+// resolveGroupID turns a group ID, ID prefix or name into a group ID.
+func resolveGroupID(ctx context.Context, c *client.Client, ref string) (string, error) {
+	groups, err := c.Groups().List(ctx, false)
+	if err != nil {
+		return "", err
+	}
+
+	candidates := make([]refCandidate, len(groups))
+	for i, g := range groups {
+		candidates[i] = refCandidate{id: g.ID.String(), name: g.Name}
+	}
+	return resolveRef("group", ref, candidates)
+}
+
+// resolveRuleID turns a rule ID, ID prefix or name into a rule ID within
+// an already resolved group.
+func resolveRuleID(ctx context.Context, c *client.Client, groupID, ref string) (string, error) {
+	rules, err := c.Rules().List(ctx, groupID)
+	if err != nil {
+		return "", err
+	}
+
+	candidates := make([]refCandidate, len(rules))
+	for i, r := range rules {
+		candidates[i] = refCandidate{id: r.ID.String(), name: r.Name}
+	}
+	return resolveRef("rule", ref, candidates)
+}
+
+// resolveGroupAndRule resolves the <GROUP> <RULE> argument pair.
+func resolveGroupAndRule(ctx context.Context, c *client.Client, groupRef, ruleRef string) (groupID, ruleID string, err error) {
+	groupID, err = resolveGroupID(ctx, c, groupRef)
+	if err != nil {
+		return "", "", err
+	}
+	ruleID, err = resolveRuleID(ctx, c, groupID, ruleRef)
+	if err != nil {
+		return "", "", err
+	}
+	return groupID, ruleID, nil
+}
@@ -1,31 +1,133 @@
 package cli
 
 import (
+	"errors"
+	"fmt"
+	"os"
+
+	"magitrickle-cli/client"
+	"magitrickle-cli/constant"
+
 	"github.com/spf13/cobra"
 )
 
 // rootCmd is the main command (entry point)
 var rootCmd = &cobra.Command{
 	Use:   "magitrickle",
-	Short: "A CLI tool for managing MagiTrickle via UNIX socket",
+	Short: "A CLI tool for managing MagiTrickle via UNIX socket or HTTP(S)",
 	Long: `MagiTrickle CLI communicates with the MagiTrickle API through a 
-UNIX socket (http://unix). It supports commands for system hooks, interfaces, 
-configuration, group management, and more.
+UNIX socket (http://unix) or, with --server, over HTTP(S). It supports commands 
+for system hooks, interfaces, configuration, group management, and more.
 	
 Try these commands:
   magitrickle system interfaces
   magitrickle group list
   magitrickle group create --name=MyGroup --interface=br0
+
+The connection target is taken from --socket/--server, then
+$MAGITRICKLE_SOCKET/$MAGITRICKLE_SERVER, then the active context of the config
+file ($XDG_CONFIG_HOME/magitrickle/config.yaml, see "magitrickle config"), and
+finally the built-in socket path. Server URLs look like unix:///path/to.sock,
+http://host:port or https://host:port.
 `,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		var err error
+		if output, err = parseOutputFormat(globalFlags.output); err != nil {
+			return err
+		}
+		return resolveClientOptions()
+	},
 }
 
-// Execute launches the root command
+// exitError makes Execute exit with a specific status code.
+type exitError struct {
+	code int
+	err  error
+}
+
+func (e *exitError) Error() string { return e.err.Error() }
+func (e *exitError) Unwrap() error { return e.err }
+
+// Execute launches the root command and exits with the status matching
+// the error, see exitCode.
 func Execute() {
-	_ = rootCmd.Execute()
+	prepareCommands(rootCmd)
+	cmd, err := rootCmd.ExecuteC()
+	if err != nil && !commandStarted && !errors.Is(err, errUsage) && !errors.Is(err, errSetup) {
+		err = withClass(err, errUsage)
+	}
+	if err != nil {
+		printError(cmd, err)
+	}
+	// The trace matters most when the command failed, so write it anyway.
+	if traceErr := writeTrace(); traceErr != nil {
+		fmt.Fprintln(os.Stderr, "Error:", traceErr)
+		if err == nil {
+			err = traceErr
+		}
+	}
+	if err != nil {
+		os.Exit(exitCode(err))
+	}
+}
+
+// writeTrace saves the requests recorded for --trace-file.
+func writeTrace() error {
+	if requestTrace == nil {
+		return nil
+	}
+	f, err := os.Create(globalFlags.traceFile)
+	if err != nil {
+		return fmt.Errorf("failed to write trace: %w", err)
+	}
+	if err := requestTrace.WriteHAR(f); err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write trace: %w", err)
+	}
+	return f.Close()
 }
 
 func init() {
+	rootCmd.Version = constant.Version + " (" + constant.Commit + ")"
+	// Errors are printed by Execute; usage is only shown on request.
+	rootCmd.SilenceErrors = true
+	rootCmd.SilenceUsage = true
+
 	rootCmd.AddCommand(systemCmd)
 	rootCmd.AddCommand(groupCmd)
 	rootCmd.AddCommand(ruleCmd)
+	rootCmd.AddCommand(applyCmd)
+	rootCmd.AddCommand(diffCmd)
+	rootCmd.AddCommand(auditCmd)
+	rootCmd.AddCommand(matchCmd)
+	rootCmd.AddCommand(explainCmd)
+	rootCmd.AddCommand(backupCmd)
+	rootCmd.AddCommand(historyCmd)
+	rootCmd.AddCommand(sourceCmd)
+	rootCmd.AddCommand(configCmd)
+	rootCmd.AddCommand(completionCmd)
+	rootCmd.CompletionOptions.DisableDefaultCmd = true
+
+	rootCmd.PersistentFlags().StringVar(&globalFlags.config, "config", "", "Path to the config file (env "+envConfig+")")
+	rootCmd.PersistentFlags().StringVarP(&globalFlags.output, "output", "o", "", "Output format: json, yaml, table, wide, name, template=<go-template> or jsonpath=<expr>")
+	rootCmd.PersistentFlags().StringVar(&globalFlags.context, "context", "", "Name of the config context to use (env "+envContext+")")
+	rootCmd.PersistentFlags().StringVar(&globalFlags.socket, "socket", "", "Path to the MagiTrickle UNIX socket (env "+envSocket+")")
+	rootCmd.PersistentFlags().StringVar(&globalFlags.server, "server", "", "Server URL: unix:///path, http://host:port or https://host:port (env "+envServer+")")
+	rootCmd.PersistentFlags().StringVar(&globalFlags.token, "token", "", "Bearer token for authentication (env "+envToken+")")
+	rootCmd.PersistentFlags().StringVar(&globalFlags.caCert, "ca-cert", "", "PEM file with CA certificates to trust for https servers")
+	rootCmd.PersistentFlags().StringVar(&globalFlags.clientCert, "client-cert", "", "PEM client certificate for https servers")
+	rootCmd.PersistentFlags().StringVar(&globalFlags.clientKey, "client-key", "", "PEM client key for https servers")
+	rootCmd.PersistentFlags().BoolVar(&globalFlags.insecureSkipVerify, "insecure-skip-verify", false, "Do not verify the server certificate (testing only)")
+	rootCmd.PersistentFlags().CountVarP(&globalFlags.verbose, "verbose", "v", "Log requests to stderr: -v method, URL, status and latency, -vv also bodies, -vvv also headers")
+	rootCmd.PersistentFlags().IntVar(&globalFlags.retries, "retries", 3, "Retries of requests that failed to connect, or idempotent ones that failed otherwise")
+	rootCmd.PersistentFlags().DurationVar(&globalFlags.retryDelay, "retry-delay", client.DefaultRetryDelay, "Delay before the first retry, doubled with every further one")
+	rootCmd.PersistentFlags().StringVar(&globalFlags.traceFile, "trace-file", "", "Write every request and response to FILE as HAR (HTTP Archive) JSON, for bug reports")
+
+	_ = rootCmd.RegisterFlagCompletionFunc("output", completeOutputFormats)
+	_ = rootCmd.RegisterFlagCompletionFunc("context", completeContexts)
+	_ = rootCmd.MarkPersistentFlagFilename("config", "yaml", "yml")
+	_ = rootCmd.MarkPersistentFlagFilename("ca-cert", "pem", "crt")
+	_ = rootCmd.MarkPersistentFlagFilename("client-cert", "pem", "crt")
+	_ = rootCmd.MarkPersistentFlagFilename("client-key", "pem", "key")
+	_ = rootCmd.MarkPersistentFlagFilename("trace-file", "har", "json")
 }
@@ -4,9 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
 	"os"
-	"strings"
 
 	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
 
@@ -18,7 +16,27 @@ var ruleCmd = &cobra.Command{
 	Use:   "rule",
 	Short: "Manage rules within groups",
 	Long: `Allows listing, creating, updating, deleting rules via 
-/api/v1/groups/{groupID}/rules/... endpoints.`,
+/api/v1/groups/{groupID}/rules/... endpoints.
+
+GROUP_ID and RULE_ID accept a full ID, a unique ID prefix of at least 4
+characters or a name (exact, or case-insensitive if unique). Rule names are looked up within the group.`,
+}
+
+// ruleView описывает вывод правил для общих форматов -o.
+var ruleView = resourceView[types.RuleRes]{
+	columns: []tableColumn[types.RuleRes]{
+		{header: "ID", value: func(r types.RuleRes) string { return r.ID.String() }},
+		{header: "NAME", value: func(r types.RuleRes) string { return r.Name }},
+		{header: "TYPE", value: func(r types.RuleRes) string { return r.Type }},
+		{header: "RULE", value: func(r types.RuleRes) string { return r.Rule }},
+		{header: "ENABLED", value: func(r types.RuleRes) string { return boolString(r.Enable) }},
+	},
+	name: func(r types.RuleRes) string { return r.ID.String() },
+}
+
+func printRuleDetails(r *types.RuleRes) {
+	fmt.Printf(" ID: %s | Name: %s | Type: %s | Rule: %s | Enabled: %v\n",
+		r.ID.String(), r.Name, r.Type, r.Rule, r.Enable)
 }
 
 // listRulesCmd – GET /api/v1/groups/{groupID}/rules
@@ -31,35 +49,29 @@ var listRulesCmd = &cobra.Command{
 for the given group ID.`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		groupID := args[0]
-		url := fmt.Sprintf("/api/v1/groups/%s/rules", groupID)
-
-		resp, err := doUnixRequest(http.MethodGet, url, nil)
+		c := newClient()
+		groupID, err := resolveGroupID(cmd.Context(), c, args[0])
 		if err != nil {
 			return err
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			return parseAPIError(resp)
-		}
-
-		var rulesRes types.RulesRes
-		if err := json.NewDecoder(resp.Body).Decode(&rulesRes); err != nil {
-			return fmt.Errorf("failed to decode RulesRes: %w", err)
-		}
-
-		if rulesRes.Rules == nil || len(*rulesRes.Rules) == 0 {
-			fmt.Println("No rules found for this group.")
-			return nil
+		rules, err := c.Rules().List(cmd.Context(), groupID)
+		if err != nil {
+			return err
 		}
 
-		fmt.Println("Rules in group", groupID, ":")
-		for _, r := range *rulesRes.Rules {
-			fmt.Printf(" - ID: %s | Name: %s | Type: %s | Rule: %s | Enabled: %v\n",
-				r.ID.String(), r.Name, r.Type, r.Rule, r.Enable)
-		}
-		return nil
+		return printList(ruleView, rules, func() {
+			if len(rules) == 0 {
+				fmt.Println("No rules found for this group.")
+				return
+			}
+
+			fmt.Println("Rules in group", groupID, ":")
+			for _, r := range rules {
+				fmt.Printf(" - ID: %s | Name: %s | Type: %s | Rule: %s | Enabled: %v\n",
+					r.ID.String(), r.Name, r.Type, r.Rule, r.Enable)
+			}
+		})
 	},
 }
 
@@ -73,7 +85,7 @@ the given group. The new set of rules must be provided in a JSON file (via --fil
 If --save is used, changes will be persisted to config immediately.`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		groupID := args[0]
+		groupRef := args[0]
 
 		filePath, _ := cmd.Flags().GetString("file")
 		if filePath == "" {
@@ -93,36 +105,40 @@ If --save is used, changes will be persisted to config immediately.`,
 			return fmt.Errorf("failed to parse JSON from file: %w", err)
 		}
 
-		// Формируем URL
-		var urlBuilder strings.Builder
-		urlBuilder.WriteString("/api/v1/groups/")
-		urlBuilder.WriteString(groupID)
-		urlBuilder.WriteString("/rules")
-		if saveFlag {
-			urlBuilder.WriteString("?save=true")
+		if rulesReq.Rules == nil {
+			return errors.New("the JSON file must contain a \"rules\" array")
+		}
+		if noValidate, _ := cmd.Flags().GetBool("no-validate"); !noValidate {
+			if err := validateRules(*rulesReq.Rules); err != nil {
+				return err
+			}
 		}
 
-		resp, err := doUnixJSON(http.MethodPut, urlBuilder.String(), rulesReq)
+		c := newClient()
+		groupID, err := resolveGroupID(cmd.Context(), c, groupRef)
 		if err != nil {
 			return err
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			return parseAPIError(resp)
-		}
 
-		var updated types.RulesRes
-		if err := json.NewDecoder(resp.Body).Decode(&updated); err != nil {
-			return fmt.Errorf("failed to decode updated RulesRes: %w", err)
+		// Сохраняем состояние группы в историю до изменения
+		snap := newSnapshot(cmd, args)
+		if err := snap.capture(cmd.Context(), c, groupID); err != nil {
+			return err
 		}
 
-		fmt.Println("Rules replaced successfully. Current rules:")
-		for _, r := range *updated.Rules {
-			fmt.Printf(" - ID: %s | Name: %s | Type: %s | Rule: %s | Enabled: %v\n",
-				r.ID.String(), r.Name, r.Type, r.Rule, r.Enable)
+		updated, err := c.Rules().Replace(cmd.Context(), groupID, *rulesReq.Rules, saveFlag)
+		if err != nil {
+			return err
 		}
-		return nil
+		snap.save()
+
+		return printList(ruleView, updated, func() {
+			fmt.Println("Rules replaced successfully. Current rules:")
+			for _, r := range updated {
+				fmt.Printf(" - ID: %s | Name: %s | Type: %s | Rule: %s | Enabled: %v\n",
+					r.ID.String(), r.Name, r.Type, r.Rule, r.Enable)
+			}
+		})
 	},
 }
 
@@ -136,7 +152,7 @@ Flags:
   --name, --type, --rule, --enable, and optional --save.`,
 	Args: cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		groupID := args[0]
+		groupRef := args[0]
 
 		name, _ := cmd.Flags().GetString("name")
 		rtype, _ := cmd.Flags().GetString("type")
@@ -144,40 +160,40 @@ Flags:
 		enable, _ := cmd.Flags().GetBool("enable")
 		saveFlag, _ := cmd.Flags().GetBool("save")
 
-		var urlBuilder strings.Builder
-		urlBuilder.WriteString("/api/v1/groups/")
-		urlBuilder.WriteString(groupID)
-		urlBuilder.WriteString("/rules")
-		if saveFlag {
-			urlBuilder.WriteString("?save=true")
-		}
-
 		reqBody := types.RuleReq{
 			Name:   name,
 			Type:   rtype,
 			Rule:   ruleStr,
 			Enable: enable,
 		}
+		if noValidate, _ := cmd.Flags().GetBool("no-validate"); !noValidate {
+			if err := validateRule("", &reqBody); err != nil {
+				return err
+			}
+		}
 
-		resp, err := doUnixJSON(http.MethodPost, urlBuilder.String(), reqBody)
+		c := newClient()
+		groupID, err := resolveGroupID(cmd.Context(), c, groupRef)
 		if err != nil {
 			return err
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			return parseAPIError(resp)
+		// Сохраняем состояние группы в историю до изменения
+		snap := newSnapshot(cmd, args)
+		if err := snap.capture(cmd.Context(), c, groupID); err != nil {
+			return err
 		}
 
-		var created types.RuleRes
-		if err := json.NewDecoder(resp.Body).Decode(&created); err != nil {
-			return fmt.Errorf("failed to decode created RuleRes: %w", err)
+		created, err := c.Rules().Create(cmd.Context(), groupID, reqBody, saveFlag)
+		if err != nil {
+			return err
 		}
+		snap.save()
 
-		fmt.Println("Rule created successfully:")
-		fmt.Printf(" ID: %s | Name: %s | Type: %s | Rule: %s | Enabled: %v\n",
-			created.ID.String(), created.Name, created.Type, created.Rule, created.Enable)
-		return nil
+		return printItem(ruleView, *created, func() {
+			fmt.Println("Rule created successfully:")
+			printRuleDetails(created)
+		})
 	},
 }
 
@@ -190,29 +206,21 @@ var getRuleCmd = &cobra.Command{
 You must provide both groupID and ruleID as arguments.`,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		groupID := args[0]
-		ruleID := args[1]
-
-		url := fmt.Sprintf("/api/v1/groups/%s/rules/%s", groupID, ruleID)
-		resp, err := doUnixRequest(http.MethodGet, url, nil)
+		c := newClient()
+		groupID, ruleID, err := resolveGroupAndRule(cmd.Context(), c, args[0], args[1])
 		if err != nil {
 			return err
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			return parseAPIError(resp)
-		}
 
-		var rule types.RuleRes
-		if err := json.NewDecoder(resp.Body).Decode(&rule); err != nil {
-			return fmt.Errorf("failed to decode RuleRes: %w", err)
+		rule, err := c.Rules().Get(cmd.Context(), groupID, ruleID)
+		if err != nil {
+			return err
 		}
 
-		fmt.Println("Rule info:")
-		fmt.Printf(" ID: %s | Name: %s | Type: %s | Rule: %s | Enabled: %v\n",
-			rule.ID.String(), rule.Name, rule.Type, rule.Rule, rule.Enable)
-		return nil
+		return printItem(ruleView, *rule, func() {
+			fmt.Println("Rule info:")
+			printRuleDetails(rule)
+		})
 	},
 }
 
@@ -222,54 +230,81 @@ var updateRuleCmd = &cobra.Command{
 	Use:   "update <GROUP_ID> <RULE_ID>",
 	Short: "Update a specific rule by ID",
 	Long: `Calls PUT /api/v1/groups/{groupID}/rules/{ruleID} to update a single rule. 
-You can provide new values via flags (name, type, rule, enable). If --save is used, 
-the config is persisted immediately.`,
+You can provide new values via flags (name, type, rule, enable). The current rule 
+is fetched first and only the flags you set are changed. If --save is used, 
+the config is persisted immediately. Use --dry-run to only print the changes.`,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		groupID := args[0]
-		ruleID := args[1]
-
-		name, _ := cmd.Flags().GetString("name")
-		rtype, _ := cmd.Flags().GetString("type")
-		ruleStr, _ := cmd.Flags().GetString("rule")
-		enable, _ := cmd.Flags().GetBool("enable")
-		saveFlag, _ := cmd.Flags().GetBool("save")
+		c := newClient()
+		groupID, ruleID, err := resolveGroupAndRule(cmd.Context(), c, args[0], args[1])
+		if err != nil {
+			return err
+		}
 
-		var urlBuilder strings.Builder
-		urlBuilder.WriteString("/api/v1/groups/")
-		urlBuilder.WriteString(groupID)
-		urlBuilder.WriteString("/rules/")
-		urlBuilder.WriteString(ruleID)
-		if saveFlag {
-			urlBuilder.WriteString("?save=true")
+		current, err := c.Rules().Get(cmd.Context(), groupID, ruleID)
+		if err != nil {
+			return err
 		}
 
+		// Берём текущее правило и меняем только явно заданные поля
 		reqBody := types.RuleReq{
-			Name:   name,
-			Type:   rtype,
-			Rule:   ruleStr,
-			Enable: enable,
+			Name:   current.Name,
+			Type:   current.Type,
+			Rule:   current.Rule,
+			Enable: current.Enable,
 		}
 
-		resp, err := doUnixJSON(http.MethodPut, urlBuilder.String(), reqBody)
-		if err != nil {
-			return err
+		var changes []fieldChange
+		applyStringFlag(cmd, "name", &reqBody.Name, &changes)
+
+		// Проверяем правило, только если заданы его тип или значение.
+		// Изменения считаем после нормализации, чтобы показать то, что
+		// будет отправлено
+		typeChanged, ruleChanged := cmd.Flags().Changed("type"), cmd.Flags().Changed("rule")
+		if typeChanged {
+			reqBody.Type, _ = cmd.Flags().GetString("type")
+		}
+		if ruleChanged {
+			reqBody.Rule, _ = cmd.Flags().GetString("rule")
+		}
+		noValidate, _ := cmd.Flags().GetBool("no-validate")
+		if !noValidate && (typeChanged || ruleChanged) {
+			if err := validateRule("", &reqBody); err != nil {
+				return err
+			}
 		}
-		defer resp.Body.Close()
+		changes = appendStringChange(changes, "type", current.Type, reqBody.Type)
+		changes = appendStringChange(changes, "rule", current.Rule, reqBody.Rule)
+		applyBoolFlag(cmd, "enable", &reqBody.Enable, &changes)
 
-		if resp.StatusCode != http.StatusOK {
-			return parseAPIError(resp)
+		if len(changes) == 0 {
+			fmt.Printf("No changes for rule %s\n", ruleID)
+			return nil
+		}
+		if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+			fmt.Printf("Rule %s would be updated (dry run):\n", ruleID)
+			printFieldChanges(changes)
+			return nil
 		}
 
-		var updated types.RuleRes
-		if err := json.NewDecoder(resp.Body).Decode(&updated); err != nil {
-			return fmt.Errorf("failed to decode updated RuleRes: %w", err)
+		saveFlag, _ := cmd.Flags().GetBool("save")
+
+		// Сохраняем состояние группы в историю до изменения
+		snap := newSnapshot(cmd, args)
+		if err := snap.capture(cmd.Context(), c, groupID); err != nil {
+			return err
 		}
 
-		fmt.Println("Rule updated successfully:")
-		fmt.Printf(" ID: %s | Name: %s | Type: %s | Rule: %s | Enabled: %v\n",
-			updated.ID.String(), updated.Name, updated.Type, updated.Rule, updated.Enable)
-		return nil
+		updated, err := c.Rules().Update(cmd.Context(), groupID, ruleID, reqBody, saveFlag)
+		if err != nil {
+			return err
+		}
+		snap.save()
+
+		return printItem(ruleView, *updated, func() {
+			fmt.Println("Rule updated successfully:")
+			printRuleDetails(updated)
+		})
 	},
 }
 
@@ -282,28 +317,24 @@ var deleteRuleCmd = &cobra.Command{
 If --save is specified, configuration changes will be persisted immediately.`,
 	Args: cobra.ExactArgs(2),
 	RunE: func(cmd *cobra.Command, args []string) error {
-		groupID := args[0]
-		ruleID := args[1]
+		c := newClient()
+		groupID, ruleID, err := resolveGroupAndRule(cmd.Context(), c, args[0], args[1])
+		if err != nil {
+			return err
+		}
 
 		saveFlag, _ := cmd.Flags().GetBool("save")
-		var urlBuilder strings.Builder
-		urlBuilder.WriteString("/api/v1/groups/")
-		urlBuilder.WriteString(groupID)
-		urlBuilder.WriteString("/rules/")
-		urlBuilder.WriteString(ruleID)
-		if saveFlag {
-			urlBuilder.WriteString("?save=true")
-		}
 
-		resp, err := doUnixRequest(http.MethodDelete, urlBuilder.String(), nil)
-		if err != nil {
+		// Сохраняем состояние группы в историю до изменения
+		snap := newSnapshot(cmd, args)
+		if err := snap.capture(cmd.Context(), c, groupID); err != nil {
 			return err
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			return parseAPIError(resp)
+		if err := c.Rules().Delete(cmd.Context(), groupID, ruleID, saveFlag); err != nil {
+			return err
 		}
+		snap.save()
 
 		fmt.Println("Rule deleted successfully")
 		return nil
@@ -311,6 +342,14 @@ If --save is specified, configuration changes will be persisted immediately.`,
 }
 
 func init() {
+	// Автодополнение аргументов <GROUP_ID> <RULE_ID> из работающего демона
+	listRulesCmd.ValidArgsFunction = groupArgCompletion
+	replaceRulesCmd.ValidArgsFunction = groupArgCompletion
+	createRuleCmd.ValidArgsFunction = groupArgCompletion
+	getRuleCmd.ValidArgsFunction = groupRuleArgsCompletion
+	updateRuleCmd.ValidArgsFunction = groupRuleArgsCompletion
+	deleteRuleCmd.ValidArgsFunction = groupRuleArgsCompletion
+
 	// Регистрируем подкоманды у ruleCmd
 	ruleCmd.AddCommand(listRulesCmd)
 	ruleCmd.AddCommand(replaceRulesCmd)
@@ -323,13 +362,17 @@ func init() {
 	// Ожидаем JSON-файл c массивом rules (types.RulesReq) через --file
 	replaceRulesCmd.Flags().String("file", "", "Path to JSON file with an array of rules")
 	replaceRulesCmd.Flags().Bool("save", false, "Save config changes (append ?save=true)")
+	replaceRulesCmd.Flags().Bool("no-validate", false, "Send the rules without checking them first")
+	_ = replaceRulesCmd.MarkFlagFilename("file", "json")
 
 	// Флаги для "create" (POST /api/v1/groups/{groupID}/rules)
 	createRuleCmd.Flags().String("name", "", "Rule name")
-	createRuleCmd.Flags().String("type", "domain", "Rule type (e.g. domain/ip/regex/etc.)")
+	createRuleCmd.Flags().String("type", "domain", "Rule type: domain, namespace, wildcard, regex, subnet or subnet6")
 	createRuleCmd.Flags().String("rule", "", "Rule value (e.g. example.com)")
 	createRuleCmd.Flags().Bool("enable", true, "Enable this rule")
 	createRuleCmd.Flags().Bool("save", false, "Save config changes (append ?save=true)")
+	createRuleCmd.Flags().Bool("no-validate", false, "Send the rule without checking it first")
+	_ = createRuleCmd.RegisterFlagCompletionFunc("type", completeRuleTypes)
 
 	// Флаги для "update" (PUT /api/v1/groups/{groupID}/rules/{ruleID})
 	updateRuleCmd.Flags().String("name", "", "New rule name")
@@ -337,6 +380,9 @@ func init() {
 	updateRuleCmd.Flags().String("rule", "", "New rule value")
 	updateRuleCmd.Flags().Bool("enable", true, "Enable/disable the rule")
 	updateRuleCmd.Flags().Bool("save", false, "Save config changes (append ?save=true)")
+	updateRuleCmd.Flags().Bool("dry-run", false, "Only print the changes that would be made")
+	updateRuleCmd.Flags().Bool("no-validate", false, "Send the rule without checking it first")
+	_ = updateRuleCmd.RegisterFlagCompletionFunc("type", completeRuleTypes)
 
 	// Флаги для "delete" (DELETE /api/v1/groups/{groupID}/rules/{ruleID})
 	deleteRuleCmd.Flags().Bool("save", false, "Save config changes (append ?save=true)")
@@ -0,0 +1,71 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"magitrickle-cli/ruleset"
+
+	"github.com/spf13/cobra"
+)
+
+var exportRulesCmd = &cobra.Command{
+	Use:   "export <GROUP_ID>",
+	Short: "Export the rules of a group in another tool's format",
+	Long: `Writes the rules of a group to --file (or stdout) in the format given by
+--format (see "rule import"). Disabled rules are written as comments. Rules
+that the format cannot express exactly are reported on stderr.
+Example:
+    magitrickle rule export Ads --format=adguard --file=ads.txt
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		formatName, _ := cmd.Flags().GetString("format")
+		filePath, _ := cmd.Flags().GetString("file")
+
+		format, err := ruleset.Lookup(formatName)
+		if err != nil {
+			return err
+		}
+		if format.Write == nil {
+			return fmt.Errorf("rules cannot be exported in %s format", format.Name)
+		}
+
+		c := newClient()
+		groupID, err := resolveGroupID(cmd.Context(), c, args[0])
+		if err != nil {
+			return err
+		}
+		rules, err := c.Rules().List(cmd.Context(), groupID)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = os.Stdout
+		if filePath != "" && filePath != "-" {
+			f, err := os.Create(filePath)
+			if err != nil {
+				return fmt.Errorf("failed to create file %s: %w", filePath, err)
+			}
+			defer f.Close()
+			w = f
+		}
+
+		issues, err := format.Write(w, rules)
+		if err != nil {
+			return fmt.Errorf("failed to write rules: %w", err)
+		}
+		printIssues(issues)
+		return nil
+	},
+}
+
+func init() {
+	ruleCmd.AddCommand(exportRulesCmd)
+
+	exportRulesCmd.Flags().String("format", "list", "Output format")
+	exportRulesCmd.Flags().StringP("file", "f", "", "Output file (default stdout)")
+	_ = exportRulesCmd.RegisterFlagCompletionFunc("format", completeRuleFormats)
+	exportRulesCmd.ValidArgsFunction = groupArgCompletion
+}
@@ -0,0 +1,241 @@
+package cli
+
+import (
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+
+	"magitrickle-cli/ruleset"
+
+	"github.com/spf13/cobra"
+)
+
+var importRulesCmd = &cobra.Command{
+	Use:   "import <GROUP_ID> [FILE]",
+	Short: "Import rules from a domain list or another tool's format",
+	Long: `Reads rules from FILE (or stdin) and adds them to the group. Supported
+formats (--format):
+  list     one entry per line; # at line start or after a space starts a
+           comment. Entries are domains (lowercased, IDN converted to
+           punycode, trailing dot removed), .example.com (namespace),
+           wildcards with * or ?, /regex/, IP addresses and CIDRs, and
+           the prefixes full:, domain:, keyword: and regexp:.
+  hosts    /etc/hosts style; every host name becomes an exact domain rule.
+  adguard  AdGuard/uBlock filter lists (also "ublock"): ||example.com^ is a
+           namespace, |example.com^ a domain, wildcards and /regex/ are
+           kept. @@ exceptions become disabled rules, $modifiers are
+           ignored and cosmetic rules skipped.
+  singbox  sing-box source rule-set: domain, domain_suffix, domain_keyword,
+           domain_regex and ip_cidr. Other fields are dropped and
+           reported; logical and inverted rules are skipped.
+  clash    Clash/mihomo rule provider, YAML payload or text: DOMAIN,
+           DOMAIN-SUFFIX, DOMAIN-KEYWORD, DOMAIN-REGEX, DOMAIN-WILDCARD,
+           IP-CIDR and IP-CIDR6 as well as domain/ipcidr provider entries.
+  geosite  v2ray/xray geosite.dat, also --geosite=FILE. --category picks the
+           categories, optionally with attributes: youtube, google@ads,
+           cn@!ads. Plain (keyword) domains become *keyword* wildcards,
+           Regex regex, Domain namespace and Full domain rules.
+  geoip    v2ray/xray geoip.dat, also --geoip=FILE, with --category=ru.
+
+Plain domains become --type rules (namespace by default, which also matches
+subdomains). Entries already present in the group are skipped. With
+--replace the group's rules are replaced by the imported ones; rules that
+are kept keep their IDs and names. A --replace that would remove all rules
+of the group is refused without --force.
+Example:
+    magitrickle rule import Streaming --format=list domains.txt --dry-run
+    magitrickle rule import Streaming --geosite=geosite.dat --category=youtube,netflix
+`,
+	Args: cobra.RangeArgs(1, 2),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		formatName, _ := cmd.Flags().GetString("format")
+		geosite, _ := cmd.Flags().GetString("geosite")
+		geoip, _ := cmd.Flags().GetString("geoip")
+		categories, _ := cmd.Flags().GetStringSlice("category")
+		domainType, _ := cmd.Flags().GetString("type")
+		replace, _ := cmd.Flags().GetBool("replace")
+		force, _ := cmd.Flags().GetBool("force")
+		saveFlag, _ := cmd.Flags().GetBool("save")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		filePath := "-"
+		if len(args) > 1 {
+			filePath = args[1]
+		}
+		// --geosite=FILE and --geoip=FILE are short for --format=... FILE;
+		// cobra rejects giving both.
+		for _, geo := range []struct{ format, file string }{{"geosite", geosite}, {"geoip", geoip}} {
+			if geo.file == "" {
+				continue
+			}
+			if len(args) > 1 || cmd.Flags().Changed("format") {
+				return fmt.Errorf("--%s cannot be combined with --format or a FILE argument", geo.format)
+			}
+			formatName, filePath = geo.format, geo.file
+		}
+		if (formatName == "geosite" || formatName == "geoip") && len(categories) == 0 {
+			return fmt.Errorf("please select the %s categories to import with --category", formatName)
+		}
+
+		format, err := ruleset.Lookup(formatName)
+		if err != nil {
+			return err
+		}
+		if domainType != ruleset.TypeNamespace && domainType != ruleset.TypeDomain {
+			return fmt.Errorf("--type must be %s or %s", ruleset.TypeNamespace, ruleset.TypeDomain)
+		}
+
+		res, err := parseRuleFile(format, filePath, ruleset.Options{DomainType: domainType, Categories: categories})
+		if err != nil {
+			return err
+		}
+		checkImported(res)
+		printIssues(res.Issues)
+
+		c := newClient()
+		groupID, err := resolveGroupID(cmd.Context(), c, args[0])
+		if err != nil {
+			return err
+		}
+		current, err := c.Rules().List(cmd.Context(), groupID)
+		if err != nil {
+			return err
+		}
+
+		merged, stats := mergeRules(current, res.Rules, replace)
+		fmt.Printf("%d rules read: %d to add, %d already present, %d to remove\n",
+			len(res.Rules), stats.added, stats.kept, stats.removed)
+		if stats.added == 0 && stats.removed == 0 {
+			return nil
+		}
+		if err := checkReplace(args[0], len(current), stats, force); err != nil {
+			return err
+		}
+		if dryRun {
+			return nil
+		}
+
+		snap := newSnapshot(cmd, args)
+		if err := snap.capture(cmd.Context(), c, groupID); err != nil {
+			return err
+		}
+		if _, err := c.Rules().Replace(cmd.Context(), groupID, merged, saveFlag); err != nil {
+			return err
+		}
+		snap.save()
+
+		fmt.Printf("Rules imported into group %s\n", groupID)
+		return nil
+	},
+}
+
+// openInput opens a file, or stdin for "-".
+func openInput(filePath string) (io.ReadCloser, error) {
+	if filePath == "-" {
+		return io.NopCloser(os.Stdin), nil
+	}
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", filePath, err)
+	}
+	return f, nil
+}
+
+// parseRuleFile parses a file, or stdin for "-".
+func parseRuleFile(format ruleset.Format, filePath string, opts ruleset.Options) (*ruleset.Result, error) {
+	r, err := openInput(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	res, err := format.Parse(r, opts)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", filePath, err)
+	}
+	return res, nil
+}
+
+// printIssues reports skipped or lossy entries on stderr.
+func printIssues(issues []ruleset.Issue) {
+	if len(issues) == 0 {
+		return
+	}
+	fmt.Fprintf(os.Stderr, "%d entries could not be converted exactly:\n", len(issues))
+	for _, issue := range issues {
+		fmt.Fprintf(os.Stderr, "  %s\n", issue)
+	}
+}
+
+type mergeStats struct {
+	added, kept, removed int
+}
+
+// checkReplace refuses a --replace that would remove every rule of a
+// group. That usually means a wrong --format or an input without valid
+// entries rather than a new list.
+func checkReplace(group string, current int, stats mergeStats, force bool) error {
+	if force || current == 0 || stats.removed < current {
+		return nil
+	}
+	return fmt.Errorf("--replace would remove all %d rules of group %s, use --force if that is intended", current, group)
+}
+
+// mergeRules returns the new rule set of a group. Imported rules that
+// already exist (same type and value) keep the existing rule. Without
+// replace all current rules are kept.
+func mergeRules(current []types.RuleRes, imported []types.RuleReq, replace bool) ([]types.RuleReq, mergeStats) {
+	var stats mergeStats
+	wanted := make(map[string]bool, len(imported))
+	for _, r := range imported {
+		wanted[ruleset.Key(r.Type, r.Rule)] = true
+	}
+
+	merged := make([]types.RuleReq, 0, len(current)+len(imported))
+	present := make(map[string]bool, len(current))
+	for _, r := range current {
+		key := ruleset.Key(r.Type, r.Rule)
+		if replace && !wanted[key] {
+			stats.removed++
+			continue
+		}
+		present[key] = true
+		id := r.ID
+		merged = append(merged, types.RuleReq{ID: &id, Name: r.Name, Type: r.Type, Rule: r.Rule, Enable: r.Enable})
+	}
+
+	for _, r := range imported {
+		key := ruleset.Key(r.Type, r.Rule)
+		if present[key] {
+			stats.kept++
+			continue
+		}
+		present[key] = true
+		merged = append(merged, r)
+		stats.added++
+	}
+	return merged, stats
+}
+
+func init() {
+	ruleCmd.AddCommand(importRulesCmd)
+
+	importRulesCmd.Flags().String("format", "list", "Input format")
+	importRulesCmd.Flags().String("geosite", "", "Import from a geosite.dat file (needs --category)")
+	importRulesCmd.Flags().String("geoip", "", "Import from a geoip.dat file (needs --category)")
+	importRulesCmd.Flags().StringSlice("category", nil, "Categories of geosite/geoip files, e.g. youtube or google@ads")
+	importRulesCmd.Flags().String("type", ruleset.TypeNamespace, "Rule type for plain domains (namespace or domain)")
+	importRulesCmd.Flags().Bool("replace", false, "Replace the group's rules instead of appending")
+	importRulesCmd.Flags().Bool("force", false, "Allow --replace to remove all rules of the group")
+	importRulesCmd.Flags().Bool("save", false, "Save config changes (append ?save=true)")
+	importRulesCmd.Flags().Bool("dry-run", false, "Only print what would change")
+	_ = importRulesCmd.RegisterFlagCompletionFunc("format", completeRuleFormats)
+	_ = importRulesCmd.RegisterFlagCompletionFunc("type", cobra.FixedCompletions(
+		[]string{ruleset.TypeNamespace, ruleset.TypeDomain}, cobra.ShellCompDirectiveNoFileComp))
+	importRulesCmd.MarkFlagsMutuallyExclusive("geosite", "geoip")
+	_ = importRulesCmd.MarkFlagFilename("geosite", "dat")
+	_ = importRulesCmd.MarkFlagFilename("geoip", "dat")
+	importRulesCmd.ValidArgsFunction = groupFileArgsCompletion
+}
@@ -0,0 +1,225 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+
+	"magitrickle-cli/client"
+	"magitrickle-cli/ruleset"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	lintError   = "error"
+	lintWarning = "warning"
+)
+
+// lintFinding is a problem with one rule.
+type lintFinding struct {
+	Group   string `json:"group"`
+	RuleID  string `json:"rule_id"`
+	Type    string `json:"type"`
+	Rule    string `json:"rule"`
+	Level   string `json:"level"`
+	Message string `json:"message"`
+}
+
+var lintView = resourceView[lintFinding]{
+	columns: []tableColumn[lintFinding]{
+		{header: "GROUP", value: func(f lintFinding) string { return f.Group }},
+		{header: "RULE ID", value: func(f lintFinding) string { return f.RuleID }},
+		{header: "TYPE", value: func(f lintFinding) string { return f.Type }},
+		{header: "RULE", value: func(f lintFinding) string { return f.Rule }},
+		{header: "LEVEL", value: func(f lintFinding) string { return f.Level }},
+		{header: "MESSAGE", value: func(f lintFinding) string { return f.Message }},
+	},
+	name: func(f lintFinding) string { return f.RuleID },
+}
+
+// validateRule normalizes the value of r in place and prints warnings on
+// stderr. ref identifies the rule in messages and may be empty.
+func validateRule(ref string, r *types.RuleReq) error {
+	normalized, warnings, err := ruleset.Validate(r.Type, r.Rule)
+	if ref != "" {
+		ref += ": "
+	}
+	if err != nil {
+		return withClass(fmt.Errorf("%s%s %q: %w", ref, r.Type, r.Rule, err), client.ErrValidation)
+	}
+	for _, w := range warnings {
+		fmt.Fprintf(os.Stderr, "Warning: %s%s %q: %s\n", ref, r.Type, r.Rule, w)
+	}
+	r.Rule = normalized
+	return nil
+}
+
+// validateRules validates every rule, printing all invalid ones before
+// failing.
+func validateRules(rules []types.RuleReq) error {
+	invalid := 0
+	for i := range rules {
+		if err := validateRule(fmt.Sprintf("rules[%d]", i), &rules[i]); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			invalid++
+		}
+	}
+	if invalid > 0 {
+		err := fmt.Errorf("%d of %d rules are invalid (use --no-validate to send them anyway)", invalid, len(rules))
+		return withClass(err, client.ErrValidation)
+	}
+	return nil
+}
+
+// checkImported validates imported rules. Warnings become issues and
+// invalid rules are dropped.
+func checkImported(res *ruleset.Result) {
+	valid := res.Rules[:0]
+	for _, r := range res.Rules {
+		text := r.Type + " " + r.Rule
+		normalized, warnings, err := ruleset.Validate(r.Type, r.Rule)
+		if err != nil {
+			res.Issues = append(res.Issues, ruleset.Issue{Text: text, Reason: err.Error()})
+			continue
+		}
+		for _, w := range warnings {
+			res.Issues = append(res.Issues, ruleset.Issue{Text: text, Reason: w})
+		}
+		r.Rule = normalized
+		valid = append(valid, r)
+	}
+	res.Rules = valid
+}
+
+// lintRule returns the findings for one rule.
+func lintRule(group, ruleID, ruleType, rule string) []lintFinding {
+	finding := lintFinding{Group: group, RuleID: ruleID, Type: ruleType, Rule: rule}
+	normalized, warnings, err := ruleset.Validate(ruleType, rule)
+	if err != nil {
+		finding.Level, finding.Message = lintError, err.Error()
+		return []lintFinding{finding}
+	}
+
+	var findings []lintFinding
+	for _, w := range warnings {
+		finding.Level, finding.Message = lintWarning, w
+		findings = append(findings, finding)
+	}
+	if normalized != rule {
+		finding.Level, finding.Message = lintWarning, "not normalized, should be "+normalized
+		findings = append(findings, finding)
+	}
+	return findings
+}
+
+var lintRulesCmd = &cobra.Command{
+	Use:   "lint [GROUP_ID...]",
+	Short: "Check rules for errors and suspicious patterns",
+	Long: `Checks the rules of the given groups (all groups by default), or of a JSON
+file for "rule replace" with --file, without changing anything:
+
+  domain, namespace  valid host names; no URLs, IPs or wildcards
+  wildcard           valid labels; patterns matching everything
+  regex              compiles; unanchored patterns, unescaped dots and
+                     uppercase letters, which never match
+  subnet, subnet6    valid CIDR of the right IP version, no host bits
+
+Values that are not in normalized form (e.g. uppercase domains) are
+reported as warnings. The same checks run before create, update, replace
+and import; --no-validate skips them there.
+Exits with status 1 if errors were found.
+Example:
+    magitrickle rule lint
+    magitrickle rule lint --file=rules.json
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		filePath, _ := cmd.Flags().GetString("file")
+
+		var findings []lintFinding
+		checked := 0
+		if filePath != "" {
+			if len(args) > 0 {
+				return errors.New("--file cannot be combined with GROUP_ID arguments")
+			}
+			content, err := os.ReadFile(filePath)
+			if err != nil {
+				return fmt.Errorf("failed to read file %s: %w", filePath, err)
+			}
+			var rulesReq types.RulesReq
+			if err := json.Unmarshal(content, &rulesReq); err != nil {
+				return fmt.Errorf("failed to parse JSON from file: %w", err)
+			}
+			if rulesReq.Rules == nil {
+				return errors.New("the JSON file must contain a \"rules\" array")
+			}
+			for i, r := range *rulesReq.Rules {
+				findings = append(findings, lintRule(filePath, fmt.Sprintf("rules[%d]", i), r.Type, r.Rule)...)
+				checked++
+			}
+		} else {
+			c := newClient()
+			var groups []types.GroupRes
+			if len(args) == 0 {
+				var err error
+				if groups, err = c.Groups().List(cmd.Context(), true); err != nil {
+					return err
+				}
+			}
+			for _, ref := range args {
+				groupID, err := resolveGroupID(cmd.Context(), c, ref)
+				if err != nil {
+					return err
+				}
+				group, err := c.Groups().Get(cmd.Context(), groupID, true)
+				if err != nil {
+					return err
+				}
+				groups = append(groups, *group)
+			}
+			for _, g := range groups {
+				if g.Rules == nil {
+					continue
+				}
+				for _, r := range *g.Rules {
+					findings = append(findings, lintRule(g.Name, r.ID.String(), r.Type, r.Rule)...)
+					checked++
+				}
+			}
+		}
+
+		errorCount := 0
+		for _, f := range findings {
+			if f.Level == lintError {
+				errorCount++
+			}
+		}
+		err := printList(lintView, findings, func() {
+			if len(findings) > 0 {
+				_ = writeTable(os.Stdout, lintView, findings, false)
+			}
+			fmt.Printf("%d rules checked: %d errors, %d warnings\n", checked, errorCount, len(findings)-errorCount)
+		})
+		if err != nil {
+			return err
+		}
+		if errorCount > 0 {
+			cmd.SilenceErrors = true
+			return &exitError{code: 1, err: fmt.Errorf("%d invalid rules found", errorCount)}
+		}
+		return nil
+	},
+}
+
+func init() {
+	ruleCmd.AddCommand(lintRulesCmd)
+
+	lintRulesCmd.Flags().String("file", "", "Lint a JSON file with an array of rules instead of the daemon's rules")
+	_ = lintRulesCmd.MarkFlagFilename("file", "json")
+	lintRulesCmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		return completeGroupIDs(cmd, toComplete)
+	}
+}
@@ -0,0 +1,462 @@
+package cli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"magitrickle-cli/client"
+	"magitrickle-cli/ruleset"
+	"magitrickle-cli/source"
+
+	"github.com/spf13/cobra"
+)
+
+const envSourcesFile = "MAGITRICKLE_SOURCES_FILE"
+
+var sourceView = resourceView[source.Source]{
+	columns: []tableColumn[source.Source]{
+		{header: "NAME", value: func(s source.Source) string { return s.Name }},
+		{header: "GROUP", value: func(s source.Source) string { return s.GroupID }},
+		{header: "FORMAT", value: func(s source.Source) string { return s.Format }},
+		{header: "URL", value: func(s source.Source) string { return s.URL }},
+		{header: "LAST SYNC", value: func(s source.Source) string { return formatSyncTime(s.LastSync) }},
+		{header: "INTERVAL", wide: true, value: func(s source.Source) string { return firstNonEmpty(s.Interval, "-") }},
+		{header: "RULES", wide: true, value: func(s source.Source) string { return strconv.Itoa(len(s.Managed)) }},
+		{header: "SERVER", wide: true, value: func(s source.Source) string { return s.Server }},
+	},
+	name: func(s source.Source) string { return s.Name },
+}
+
+func formatSyncTime(t time.Time) string {
+	if t.IsZero() {
+		return "never"
+	}
+	return t.Local().Format("2006-01-02 15:04:05")
+}
+
+// sourcesFile is $MAGITRICKLE_SOURCES_FILE or
+// $XDG_STATE_HOME/magitrickle/sources.json.
+func sourcesFile() (string, error) {
+	if path := os.Getenv(envSourcesFile); path != "" {
+		return path, nil
+	}
+	dir, err := stateDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to locate sources file: %w", err)
+	}
+	return filepath.Join(dir, "sources.json"), nil
+}
+
+func loadSources() ([]source.Source, error) {
+	path, err := sourcesFile()
+	if err != nil {
+		return nil, err
+	}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read sources: %w", err)
+	}
+	var sources []source.Source
+	if err := json.Unmarshal(content, &sources); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return sources, nil
+}
+
+func saveSources(sources []source.Source) error {
+	path, err := sourcesFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	if sources == nil {
+		sources = []source.Source{}
+	}
+	content, err := json.MarshalIndent(sources, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, append(content, '\n'), 0o600); err != nil {
+		return fmt.Errorf("failed to write sources: %w", err)
+	}
+	return nil
+}
+
+func findSource(sources []source.Source, name string) (int, error) {
+	for i := range sources {
+		if sources[i].Name == name {
+			return i, nil
+		}
+	}
+	return -1, withClass(fmt.Errorf("source %q not found", name), client.ErrNotFound)
+}
+
+// sharedKeys returns the keys managed by the other sources of the group of
+// sources[i].
+func sharedKeys(sources []source.Source, i int) []string {
+	var keys []string
+	for j := range sources {
+		if j != i && sources[j].Server == sources[i].Server && sources[j].GroupID == sources[i].GroupID {
+			keys = append(keys, sources[j].Managed...)
+		}
+	}
+	return keys
+}
+
+var sourceCmd = &cobra.Command{
+	Use:   "source",
+	Short: "Mirror rule lists published over HTTP into groups",
+	Long: `A source keeps the rules of a group in sync with a list published over
+HTTP, in any format "rule import" understands. "source sync" downloads the
+lists and replaces the rules the source added earlier; rules added by hand
+or still listed by another source of the group stay in place. Sources are stored in $XDG_STATE_HOME/magitrickle/sources.json
+(or $MAGITRICKLE_SOURCES_FILE) together with the server they belong to.
+
+Run "source sync" from cron or a timer to keep the groups up to date; lists
+that did not change (ETag/Last-Modified) are not downloaded again, and
+sources with --interval are only synced when it has passed.`,
+}
+
+var addSourceCmd = &cobra.Command{
+	Use:   "add <GROUP_ID>",
+	Short: "Mirror a rule list into a group",
+	Long: `Registers a list to mirror into the group. Nothing is downloaded until
+"source sync" runs.
+Example:
+    magitrickle source add Ads --url=https://example.org/filters.txt --format=adguard --interval=12h
+    magitrickle source sync Ads --save
+`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, _ := cmd.Flags().GetString("name")
+		rawURL, _ := cmd.Flags().GetString("url")
+		formatName, _ := cmd.Flags().GetString("format")
+		domainType, _ := cmd.Flags().GetString("type")
+		categories, _ := cmd.Flags().GetStringSlice("category")
+		interval, _ := cmd.Flags().GetString("interval")
+
+		if u, err := url.Parse(rawURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid --url %q, expected an http:// or https:// URL", rawURL)
+		}
+		format, err := ruleset.Lookup(formatName)
+		if err != nil {
+			return err
+		}
+		if format.Parse == nil {
+			return fmt.Errorf("rules cannot be imported from %s format", format.Name)
+		}
+		if (formatName == "geosite" || formatName == "geoip") && len(categories) == 0 {
+			return fmt.Errorf("please select the %s categories to import with --category", formatName)
+		}
+		if domainType != ruleset.TypeNamespace && domainType != ruleset.TypeDomain {
+			return fmt.Errorf("--type must be %s or %s", ruleset.TypeNamespace, ruleset.TypeDomain)
+		}
+		if interval != "" {
+			if d, err := time.ParseDuration(interval); err != nil || d <= 0 {
+				return fmt.Errorf("invalid --interval %q, expected a duration such as 6h", interval)
+			}
+		}
+
+		c := newClient()
+		groupID, err := resolveGroupID(cmd.Context(), c, args[0])
+		if err != nil {
+			return err
+		}
+		if name == "" {
+			group, err := c.Groups().Get(cmd.Context(), groupID, false)
+			if err != nil {
+				return err
+			}
+			name = group.Name
+		}
+
+		sources, err := loadSources()
+		if err != nil {
+			return err
+		}
+		if _, err := findSource(sources, name); err == nil {
+			return fmt.Errorf("source %q already exists, choose another one with --name", name)
+		}
+		sources = append(sources, source.Source{
+			Name:       name,
+			Server:     currentSource(),
+			GroupID:    groupID,
+			URL:        rawURL,
+			Format:     format.Name,
+			DomainType: domainType,
+			Categories: categories,
+			Interval:   interval,
+		})
+		if err := saveSources(sources); err != nil {
+			return err
+		}
+
+		fmt.Printf("Source %s added for group %s, run 'magitrickle source sync %s' to fetch it\n", name, groupID, name)
+		return nil
+	},
+}
+
+var listSourcesCmd = &cobra.Command{
+	Use:     "list",
+	Aliases: []string{"ls"},
+	Short:   "List sources",
+	Args:    cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		sources, err := loadSources()
+		if err != nil {
+			return err
+		}
+
+		return printList(sourceView, sources, func() {
+			if len(sources) == 0 {
+				fmt.Println("No sources.")
+				return
+			}
+			_ = writeTable(os.Stdout, sourceView, sources, false)
+		})
+	},
+}
+
+var removeSourceCmd = &cobra.Command{
+	Use:     "remove <NAME>",
+	Aliases: []string{"rm"},
+	Short:   "Stop mirroring a list",
+	Long: `Removes a source. The rules it added stay in the group as if they had been
+added by hand, unless --delete-rules is given. Rules that other sources of
+the group still list are never deleted.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		deleteRules, _ := cmd.Flags().GetBool("delete-rules")
+		saveFlag, _ := cmd.Flags().GetBool("save")
+
+		sources, err := loadSources()
+		if err != nil {
+			return err
+		}
+		i, err := findSource(sources, args[0])
+		if err != nil {
+			return err
+		}
+		s := sources[i]
+
+		if deleteRules {
+			if server := currentSource(); s.Server != server {
+				return fmt.Errorf("source %s belongs to %s, not %s", s.Name, s.Server, server)
+			}
+			c := newClient()
+			current, err := c.Rules().List(cmd.Context(), s.GroupID)
+			if err != nil {
+				return err
+			}
+			rules, _, stats := source.Merge(current, s.Managed, sharedKeys(sources, i), nil)
+			if stats.Changed() {
+				snap := newSnapshot(cmd, args)
+				if err := snap.capture(cmd.Context(), c, s.GroupID); err != nil {
+					return err
+				}
+				if _, err := c.Rules().Replace(cmd.Context(), s.GroupID, rules, saveFlag); err != nil {
+					return err
+				}
+				snap.save()
+			}
+			fmt.Printf("%d rules deleted from group %s\n", stats.Removed, s.GroupID)
+		}
+
+		sources = append(sources[:i], sources[i+1:]...)
+		if err := saveSources(sources); err != nil {
+			return err
+		}
+		fmt.Printf("Source %s removed\n", s.Name)
+		return nil
+	},
+}
+
+var syncSourcesCmd = &cobra.Command{
+	Use:   "sync [NAME...]",
+	Short: "Download sources and update their groups",
+	Long: `Downloads the named sources, or all sources of the current server that are
+due, and updates their groups: rules that left a list are removed, new ones
+are added, and rules the source did not add are never touched. Unchanged
+lists are detected with ETag and Last-Modified.
+
+A list that suddenly contains no rules is not applied, as this usually
+means a broken download; --force applies it anyway, and also downloads the
+lists again regardless of caching and interval.
+Example:
+    magitrickle source sync --save
+    */30 * * * * magitrickle source sync --save   (crontab)
+`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		force, _ := cmd.Flags().GetBool("force")
+		saveFlag, _ := cmd.Flags().GetBool("save")
+		dryRun, _ := cmd.Flags().GetBool("dry-run")
+
+		sources, err := loadSources()
+		if err != nil {
+			return err
+		}
+		server := currentSource()
+		var selected []int
+		if len(args) > 0 {
+			for _, name := range args {
+				i, err := findSource(sources, name)
+				if err != nil {
+					return err
+				}
+				if sources[i].Server != server {
+					return fmt.Errorf("source %s belongs to %s, not %s", name, sources[i].Server, server)
+				}
+				selected = append(selected, i)
+			}
+		} else {
+			now := time.Now()
+			for i := range sources {
+				if sources[i].Server == server && (force || sources[i].Due(now)) {
+					selected = append(selected, i)
+				}
+			}
+			if len(selected) == 0 {
+				fmt.Println("No sources due.")
+				return nil
+			}
+		}
+
+		c := newClient()
+		fetcher := source.Fetcher{Force: force}
+		snap := newSnapshot(cmd, args)
+		captured := make(map[string]bool)
+		failed := 0
+		for _, i := range selected {
+			s := &sources[i]
+			dl, err := fetcher.Fetch(cmd.Context(), s)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", s.Name, err)
+				failed++
+				continue
+			}
+			if dl.NotModified {
+				fmt.Printf("%s: not modified\n", s.Name)
+				s.LastSync = time.Now().UTC().Truncate(time.Second)
+				continue
+			}
+
+			res, err := s.Parse(dl.Body)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", s.Name, err)
+				failed++
+				continue
+			}
+			checkImported(res)
+			printIssues(res.Issues)
+			if len(res.Rules) == 0 && len(s.Managed) > 0 && !force {
+				fmt.Fprintf(os.Stderr, "%s: the list contains no rules, keeping the %d current ones (use --force to apply it)\n",
+					s.Name, len(s.Managed))
+				failed++
+				continue
+			}
+
+			current, err := c.Rules().List(cmd.Context(), s.GroupID)
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "%s: %v\n", s.Name, err)
+				failed++
+				continue
+			}
+			rules, managed, stats := source.Merge(current, s.Managed, sharedKeys(sources, i), res.Rules)
+			fmt.Printf("%s: %d rules fetched: %d to add, %d already present, %d to remove\n",
+				s.Name, len(res.Rules), stats.Added, stats.Kept, stats.Removed)
+			if dryRun {
+				continue
+			}
+
+			if stats.Changed() {
+				if !captured[s.GroupID] {
+					if err := snap.capture(cmd.Context(), c, s.GroupID); err != nil {
+						fmt.Fprintf(os.Stderr, "%s: %v\n", s.Name, err)
+						failed++
+						continue
+					}
+					captured[s.GroupID] = true
+				}
+				if _, err := c.Rules().Replace(cmd.Context(), s.GroupID, rules, saveFlag); err != nil {
+					fmt.Fprintf(os.Stderr, "%s: %v\n", s.Name, err)
+					failed++
+					continue
+				}
+			}
+			s.ETag, s.LastModified, s.Managed = dl.ETag, dl.LastModified, managed
+			s.LastSync = time.Now().UTC().Truncate(time.Second)
+		}
+
+		if !dryRun {
+			snap.save()
+			if err := saveSources(sources); err != nil {
+				return err
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d sources failed to sync", failed, len(selected))
+		}
+		return nil
+	},
+}
+
+// completeSourceNames completes source names with their URL as description.
+func completeSourceNames(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	sources, err := loadSources()
+	if err != nil {
+		return nil, cobra.ShellCompDirectiveError
+	}
+	var names []string
+	for _, s := range sources {
+		if strings.HasPrefix(s.Name, toComplete) {
+			names = append(names, s.Name+"\t"+s.URL)
+		}
+	}
+	return names, cobra.ShellCompDirectiveNoFileComp
+}
+
+func init() {
+	sourceCmd.AddCommand(addSourceCmd)
+	sourceCmd.AddCommand(listSourcesCmd)
+	sourceCmd.AddCommand(removeSourceCmd)
+	sourceCmd.AddCommand(syncSourcesCmd)
+
+	addSourceCmd.Flags().String("name", "", "Name of the source (default the group name)")
+	addSourceCmd.Flags().String("url", "", "URL of the list")
+	addSourceCmd.Flags().String("format", "list", "Format of the list, as for 'rule import'")
+	addSourceCmd.Flags().String("type", ruleset.TypeNamespace, "Rule type for plain domains (namespace or domain)")
+	addSourceCmd.Flags().StringSlice("category", nil, "Categories of geosite/geoip lists")
+	addSourceCmd.Flags().String("interval", "", "Minimum time between scheduled syncs, e.g. 6h")
+	_ = addSourceCmd.MarkFlagRequired("url")
+	_ = addSourceCmd.RegisterFlagCompletionFunc("format", completeRuleFormats)
+	_ = addSourceCmd.RegisterFlagCompletionFunc("type", cobra.FixedCompletions(
+		[]string{ruleset.TypeNamespace, ruleset.TypeDomain}, cobra.ShellCompDirectiveNoFileComp))
+	addSourceCmd.ValidArgsFunction = groupArgCompletion
+
+	removeSourceCmd.Flags().Bool("delete-rules", false, "Also delete the rules the source added")
+	removeSourceCmd.Flags().Bool("save", false, "Save config changes (append ?save=true)")
+	removeSourceCmd.ValidArgsFunction = func(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+		if len(args) > 0 {
+			return nil, cobra.ShellCompDirectiveNoFileComp
+		}
+		return completeSourceNames(cmd, args, toComplete)
+	}
+
+	syncSourcesCmd.Flags().Bool("force", false, "Ignore caching and intervals and apply empty lists")
+	syncSourcesCmd.Flags().Bool("save", false, "Save config changes (append ?save=true)")
+	syncSourcesCmd.Flags().Bool("dry-run", false, "Only print what would change")
+	syncSourcesCmd.ValidArgsFunction = completeSourceNames
+}
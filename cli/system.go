@@ -1,15 +1,24 @@
 package cli
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
-	"net/http"
+	"time"
 
 	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
 
 	"github.com/spf13/cobra"
 )
 
+// interfaceView renders interfaces for the shared -o formats.
+var interfaceView = resourceView[types.InterfaceRes]{
+	columns: []tableColumn[types.InterfaceRes]{
+		{header: "ID", value: func(i types.InterfaceRes) string { return i.ID }},
+	},
+	name: func(i types.InterfaceRes) string { return i.ID },
+}
+
 // systemCmd is the parent command for system-related operations
 var systemCmd = &cobra.Command{
 	Use:   "system",
@@ -28,19 +37,9 @@ var netfilterdCmd = &cobra.Command{
 		hookType, _ := cmd.Flags().GetString("type")
 		table, _ := cmd.Flags().GetString("table")
 
-		reqData := types.NetfilterDHookReq{
-			Type:  hookType,
-			Table: table,
-		}
-		resp, err := doUnixJSON(http.MethodPost, "/api/v1/system/hooks/netfilterd", reqData)
-		if err != nil {
+		if err := newClient().System().NetfilterDHook(cmd.Context(), hookType, table); err != nil {
 			return err
 		}
-		defer resp.Body.Close()
-
-		if resp.StatusCode != http.StatusOK {
-			return parseAPIError(resp)
-		}
 		fmt.Println("Netfilterd hook triggered successfully")
 		return nil
 	},
@@ -52,31 +51,22 @@ var interfacesCmd = &cobra.Command{
 	Long: `Lists all available interfaces recognized by MagiTrickle
 by sending a GET request to /api/v1/system/interfaces.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		resp, err := doUnixRequest(http.MethodGet, "/api/v1/system/interfaces", nil)
+		ifaces, err := newClient().System().Interfaces(cmd.Context())
 		if err != nil {
 			return err
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != http.StatusOK {
-			return parseAPIError(resp)
-		}
-
-		var ifaces types.InterfacesRes
-		if err := json.NewDecoder(resp.Body).Decode(&ifaces); err != nil {
-			return fmt.Errorf("failed to decode InterfacesRes: %w", err)
-		}
-
-		if len(ifaces.Interfaces) == 0 {
-			fmt.Println("No interfaces found.")
-			return nil
-		}
-
-		fmt.Println("Available Interfaces:")
-		for _, iface := range ifaces.Interfaces {
-			fmt.Printf("  - %s\n", iface.ID)
-		}
-		return nil
+		return printList(interfaceView, ifaces, func() {
+			if len(ifaces) == 0 {
+				fmt.Println("No interfaces found.")
+				return
+			}
+
+			fmt.Println("Available Interfaces:")
+			for _, iface := range ifaces {
+				fmt.Printf("  - %s\n", iface.ID)
+			}
+		})
 	},
 }
 
@@ -85,16 +75,43 @@ var saveConfigCmd = &cobra.Command{
 	Short: "Save the current configuration",
 	Long:  `Saves the current MagiTrickle configuration to persistent storage.`,
 	RunE: func(cmd *cobra.Command, args []string) error {
-		resp, err := doUnixRequest(http.MethodPost, "/api/v1/system/config/save", nil)
-		if err != nil {
+		if err := newClient().System().SaveConfig(cmd.Context()); err != nil {
 			return err
 		}
-		defer resp.Body.Close()
+		fmt.Println("Configuration saved successfully")
+		return nil
+	},
+}
 
-		if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
-			return parseAPIError(resp)
+var waitCmd = &cobra.Command{
+	Use:   "wait",
+	Short: "Wait until the MagiTrickle API responds",
+	Long: `Blocks until the daemon answers API requests, polling every --interval.
+Useful in init scripts and netfilter.d hooks that run before the daemon has
+created its socket. Fails with exit status 3 if the API does not respond
+within --timeout (0 waits forever).
+Example:
+    magitrickle system wait --timeout=60s && magitrickle apply -f policy.yaml
+`,
+	Args: cobra.NoArgs,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		timeout, _ := cmd.Flags().GetDuration("timeout")
+		interval, _ := cmd.Flags().GetDuration("interval")
+		if interval <= 0 {
+			return withClass(errors.New("--interval must be positive"), errUsage)
 		}
-		fmt.Println("Configuration saved successfully")
+
+		ctx := cmd.Context()
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		start := time.Now()
+		if err := newClient().Wait(ctx, interval); err != nil {
+			return err
+		}
+		fmt.Printf("MagiTrickle API is up (waited %s)\n", time.Since(start).Round(time.Millisecond))
 		return nil
 	},
 }
@@ -103,6 +120,10 @@ func init() {
 	systemCmd.AddCommand(netfilterdCmd)
 	systemCmd.AddCommand(interfacesCmd)
 	systemCmd.AddCommand(saveConfigCmd)
+	systemCmd.AddCommand(waitCmd)
+
+	waitCmd.Flags().Duration("timeout", 60*time.Second, "How long to wait at most, 0 for no limit")
+	waitCmd.Flags().Duration("interval", time.Second, "Delay between attempts")
 
 	netfilterdCmd.Flags().String("type", "filter", "Hook type (e.g., 'filter', 'nat')")
 	netfilterdCmd.Flags().String("table", "filter", "Netfilter table (e.g., 'filter', 'nat')")
@@ -0,0 +1,52 @@
+package cli
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/spf13/cobra"
+)
+
+// fieldChange is one field modified by an update command.
+type fieldChange struct {
+	field string
+	from  string
+	to    string
+}
+
+// applyStringFlag copies a string flag into target if the user set it,
+// recording the change. The field is named after the flag.
+func applyStringFlag(cmd *cobra.Command, flag string, target *string, changes *[]fieldChange) {
+	if !cmd.Flags().Changed(flag) {
+		return
+	}
+	value, _ := cmd.Flags().GetString(flag)
+	*changes = appendStringChange(*changes, flag, *target, value)
+	*target = value
+}
+
+// appendStringChange records a string field if it differs.
+func appendStringChange(changes []fieldChange, field, from, to string) []fieldChange {
+	if from == to {
+		return changes
+	}
+	return append(changes, fieldChange{field: field, from: strconv.Quote(from), to: strconv.Quote(to)})
+}
+
+// applyBoolFlag is applyStringFlag for bool flags.
+func applyBoolFlag(cmd *cobra.Command, flag string, target *bool, changes *[]fieldChange) {
+	if !cmd.Flags().Changed(flag) {
+		return
+	}
+	value, _ := cmd.Flags().GetBool(flag)
+	if value != *target {
+		*changes = append(*changes, fieldChange{field: flag, from: strconv.FormatBool(*target), to: strconv.FormatBool(value)})
+	}
+	*target = value
+}
+
+func printFieldChanges(changes []fieldChange) {
+	for _, c := range changes {
+		fmt.Printf("  %s: %s -> %s\n", c.field, c.from, c.to)
+	}
+}
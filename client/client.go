@@ -0,0 +1,216 @@
+// Package client provides a typed Go client for the MagiTrickle HTTP API.
+//
+// A Client talks to the daemon over its UNIX socket, or over HTTP(S) when a
+// server URL is given, and exposes every /api/v1 endpoint through small
+// service types:
+//
+//	c := client.New(client.Options{})
+//	groups, err := c.Groups().List(ctx, true)
+package client
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"time"
+
+	api "github.com/Ponywka/MagiTrickle/backend/pkg/api"
+)
+
+// DefaultTimeout is used when Options.Timeout is zero.
+const DefaultTimeout = 10 * time.Second
+
+// Options configures a Client. The zero value connects to the default
+// MagiTrickle socket.
+type Options struct {
+	// Server is the daemon URL: unix:///path/to.sock, http://host:port or
+	// https://host:port. When empty, SocketPath is used.
+	Server string
+	// SocketPath is the UNIX socket of the daemon. Defaults to api.SocketPath.
+	SocketPath string
+	// Token is sent as a bearer token in the Authorization header.
+	Token string
+	// TLSConfig is used for https:// servers.
+	TLSConfig *tls.Config
+	// Timeout limits every request. Defaults to DefaultTimeout.
+	Timeout time.Duration
+	// HTTPClient overrides the HTTP client entirely (useful in tests).
+	HTTPClient *http.Client
+
+	// Verbosity logs every request to LogOutput, see LogRequests,
+	// LogBodies and LogHeaders. Secrets are redacted.
+	Verbosity int
+	// LogOutput receives the request log. Defaults to os.Stderr.
+	LogOutput io.Writer
+	// Trace, if set, records every request and response.
+	Trace *Trace
+
+	// Retries is how often a failed request is repeated: always when the
+	// daemon could not be reached, and for idempotent methods also after
+	// other transport errors and 502, 503 and 504 responses.
+	Retries int
+	// RetryDelay is the wait before the first retry. It doubles with every
+	// attempt, up to 5 seconds. Defaults to DefaultRetryDelay.
+	RetryDelay time.Duration
+}
+
+// Client is a MagiTrickle API client. It is safe for concurrent use.
+type Client struct {
+	httpClient *http.Client
+	baseURL    string
+	token      string
+	retries    int
+	retryDelay time.Duration
+	// log receives retry notices when Options.Verbosity is set.
+	log io.Writer
+	// err is a configuration error reported by every request.
+	err error
+}
+
+// New creates a Client from opts. An invalid Server URL is reported by the
+// first request.
+func New(opts Options) *Client {
+	if opts.SocketPath == "" {
+		opts.SocketPath = api.SocketPath
+	}
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	if opts.RetryDelay == 0 {
+		opts.RetryDelay = DefaultRetryDelay
+	}
+
+	t := target{socketPath: opts.SocketPath, baseURL: "http://unix"}
+	if opts.Server != "" {
+		var err error
+		t, err = parseServer(opts.Server)
+		if err != nil {
+			return &Client{err: err}
+		}
+	}
+
+	httpClient := opts.HTTPClient
+	if httpClient == nil {
+		var tr http.RoundTripper
+		if t.socketPath != "" {
+			tr = newUnixTransport(t.socketPath)
+		} else {
+			tr = newTCPTransport(opts.TLSConfig)
+		}
+		httpClient = &http.Client{
+			Transport: tr,
+			Timeout:   opts.Timeout,
+		}
+	}
+
+	if opts.Verbosity > 0 || opts.Trace != nil {
+		next := httpClient.Transport
+		if next == nil {
+			next = http.DefaultTransport
+		}
+		if opts.LogOutput == nil {
+			opts.LogOutput = os.Stderr
+		}
+		wrapped := *httpClient
+		wrapped.Transport = &debugTransport{
+			next:      next,
+			verbosity: opts.Verbosity,
+			log:       opts.LogOutput,
+			trace:     opts.Trace,
+		}
+		httpClient = &wrapped
+	}
+
+	c := &Client{
+		httpClient: httpClient,
+		baseURL:    t.baseURL,
+		token:      opts.Token,
+		retries:    opts.Retries,
+		retryDelay: opts.RetryDelay,
+	}
+	if opts.Verbosity > 0 {
+		c.log = opts.LogOutput
+	}
+	return c
+}
+
+// Groups returns the service for /api/v1/groups endpoints.
+func (c *Client) Groups() *GroupsService {
+	return &GroupsService{c: c}
+}
+
+// Rules returns the service for /api/v1/groups/{groupID}/rules endpoints.
+func (c *Client) Rules() *RulesService {
+	return &RulesService{c: c}
+}
+
+// System returns the service for /api/v1/system endpoints.
+func (c *Client) System() *SystemService {
+	return &SystemService{c: c}
+}
+
+// Do sends a request to urlPath with an optional JSON body and decodes a
+// successful JSON response into out (if non-nil). Non-2xx responses are
+// returned as *APIError, transport failures wrap ErrConnection.
+func (c *Client) Do(ctx context.Context, method, urlPath string, query url.Values, in, out interface{}) error {
+	if c.err != nil {
+		return c.err
+	}
+
+	var reqBody io.Reader
+	if in != nil {
+		body, err := json.Marshal(in)
+		if err != nil {
+			return fmt.Errorf("json marshal fail: %w", err)
+		}
+		reqBody = bytes.NewReader(body)
+	}
+
+	u := c.baseURL + urlPath
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, reqBody)
+	if err != nil {
+		return fmt.Errorf("create request fail: %w", err)
+	}
+	req.Header.Set("Accept", "application/json")
+	if in != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.send(req)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrConnection, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return parseAPIError(resp)
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode %T: %w", out, err)
+	}
+	return nil
+}
+
+func saveQuery(save bool) url.Values {
+	if !save {
+		return nil
+	}
+	return url.Values{"save": {"true"}}
+}
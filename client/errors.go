@@ -0,0 +1,107 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+)
+
+// Error classes. Errors returned by a Client wrap the matching class, so
+// callers can tell them apart with errors.Is.
+var (
+	// ErrConnection means the daemon could not be reached or did not answer.
+	ErrConnection = errors.New("cannot connect to the daemon")
+	// ErrUnauthorized is a 401 or 403 response.
+	ErrUnauthorized = errors.New("unauthorized")
+	// ErrNotFound is a 404 response.
+	ErrNotFound = errors.New("not found")
+	// ErrValidation is a 400 or 422 response: the daemon rejected the request.
+	ErrValidation = errors.New("invalid request")
+	// ErrConflict is a 409 or 412 response.
+	ErrConflict = errors.New("conflict")
+	// ErrServer is a 5xx response.
+	ErrServer = errors.New("server error")
+)
+
+// APIError is returned for every non-2xx response from the daemon.
+type APIError struct {
+	// Method and Path identify the failed request.
+	Method     string
+	Path       string
+	StatusCode int
+	// Message is the "error" field of types.ErrorRes, if the body had one.
+	Message string
+	// Body is the raw response body.
+	Body []byte
+}
+
+// maxErrorBody limits how much of a body that is not an ErrorRes is shown.
+const maxErrorBody = 200
+
+func (e *APIError) Error() string {
+	msg := e.Message
+	if msg == "" {
+		msg = strings.TrimSpace(string(e.Body))
+		if len(msg) > maxErrorBody {
+			msg = msg[:maxErrorBody] + "..."
+		}
+	}
+
+	var b strings.Builder
+	if e.Method != "" {
+		fmt.Fprintf(&b, "%s %s: ", e.Method, e.Path)
+	}
+	if msg == "" {
+		fmt.Fprintf(&b, "request failed with status code %d", e.StatusCode)
+	} else {
+		fmt.Fprintf(&b, "api error %d: %s", e.StatusCode, msg)
+	}
+	return b.String()
+}
+
+// Is reports whether target is the error class of the status code.
+func (e *APIError) Is(target error) bool {
+	class := e.class()
+	return class != nil && target == class
+}
+
+func (e *APIError) class() error {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized, e.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusBadRequest, e.StatusCode == http.StatusUnprocessableEntity:
+		return ErrValidation
+	case e.StatusCode == http.StatusConflict, e.StatusCode == http.StatusPreconditionFailed:
+		return ErrConflict
+	case e.StatusCode >= 500:
+		return ErrServer
+	}
+	return nil
+}
+
+func parseAPIError(resp *http.Response) error {
+	apiErr := &APIError{StatusCode: resp.StatusCode}
+	if resp.Request != nil {
+		apiErr.Method = resp.Request.Method
+		apiErr.Path = resp.Request.URL.Path
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	apiErr.Body = body
+	if err != nil {
+		apiErr.Message = fmt.Sprintf("(body read error: %v)", err)
+		return apiErr
+	}
+	var errRes types.ErrorRes
+	if json.Unmarshal(body, &errRes) == nil {
+		apiErr.Message = errRes.Error
+	}
+	return apiErr
+}
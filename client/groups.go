@@ -0,0 +1,86 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+)
+
+// GroupsService wraps the /api/v1/groups endpoints.
+type GroupsService struct {
+	c *Client
+}
+
+// List returns all groups, optionally with their rules.
+func (s *GroupsService) List(ctx context.Context, withRules bool) ([]types.GroupRes, error) {
+	var query url.Values
+	if withRules {
+		query = url.Values{"with_rules": {"true"}}
+	}
+
+	var res types.GroupsRes
+	if err := s.c.Do(ctx, http.MethodGet, "/api/v1/groups", query, nil, &res); err != nil {
+		return nil, err
+	}
+	if res.Groups == nil {
+		return nil, nil
+	}
+	return *res.Groups, nil
+}
+
+// ReplaceAll replaces the complete list of groups.
+func (s *GroupsService) ReplaceAll(ctx context.Context, groups []types.GroupReq, save bool) ([]types.GroupRes, error) {
+	var res types.GroupsRes
+	req := types.GroupsReq{Groups: &groups}
+	if err := s.c.Do(ctx, http.MethodPut, "/api/v1/groups", saveQuery(save), req, &res); err != nil {
+		return nil, err
+	}
+	if res.Groups == nil {
+		return nil, nil
+	}
+	return *res.Groups, nil
+}
+
+// Get returns a single group.
+func (s *GroupsService) Get(ctx context.Context, groupID string, withRules bool) (*types.GroupRes, error) {
+	var query url.Values
+	if withRules {
+		query = url.Values{"with_rules": {"true"}}
+	}
+
+	var res types.GroupRes
+	if err := s.c.Do(ctx, http.MethodGet, groupPath(groupID), query, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Create creates a new group.
+func (s *GroupsService) Create(ctx context.Context, req types.GroupReq, save bool) (*types.GroupRes, error) {
+	var res types.GroupRes
+	if err := s.c.Do(ctx, http.MethodPost, "/api/v1/groups", saveQuery(save), req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Update replaces the fields of an existing group. Rules are left untouched
+// when req.Rules is nil.
+func (s *GroupsService) Update(ctx context.Context, groupID string, req types.GroupReq, save bool) (*types.GroupRes, error) {
+	var res types.GroupRes
+	if err := s.c.Do(ctx, http.MethodPut, groupPath(groupID), saveQuery(save), req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Delete removes a group.
+func (s *GroupsService) Delete(ctx context.Context, groupID string, save bool) error {
+	return s.c.Do(ctx, http.MethodDelete, groupPath(groupID), saveQuery(save), nil, nil)
+}
+
+func groupPath(groupID string) string {
+	return "/api/v1/groups/" + url.PathEscape(groupID)
+}
@@ -0,0 +1,112 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"time"
+)
+
+// DefaultRetryDelay is used when Options.RetryDelay is zero.
+const DefaultRetryDelay = 250 * time.Millisecond
+
+// maxRetryDelay caps the exponential backoff.
+const maxRetryDelay = 5 * time.Second
+
+// send performs req and repeats it as configured by Options.Retries,
+// doubling the delay after every attempt.
+func (c *Client) send(req *http.Request) (*http.Response, error) {
+	delay := c.retryDelay
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, err
+			}
+			req.Body = body
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if attempt >= c.retries || !retryable(req, resp, err) {
+			return resp, err
+		}
+		reason := ""
+		if err != nil {
+			reason = err.Error()
+		} else {
+			reason = resp.Status
+			_, _ = io.Copy(io.Discard, resp.Body)
+			resp.Body.Close()
+		}
+		if c.log != nil {
+			fmt.Fprintf(c.log, "Retrying %s %s in %s (%d of %d): %s\n",
+				req.Method, req.URL.Path, delay, attempt+1, c.retries, reason)
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-req.Context().Done():
+			timer.Stop()
+			if err == nil {
+				err = req.Context().Err()
+			}
+			return nil, err
+		case <-timer.C:
+		}
+		delay = min(delay*2, maxRetryDelay)
+	}
+}
+
+// retryable reports whether a failed attempt may be repeated. Requests that
+// never reached the daemon are always safe to repeat, others only if their
+// method is idempotent.
+func retryable(req *http.Request, resp *http.Response, err error) bool {
+	if req.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) && opErr.Op == "dial" {
+			return true
+		}
+		return idempotent(req.Method)
+	}
+	switch resp.StatusCode {
+	case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return idempotent(req.Method)
+	}
+	return false
+}
+
+func idempotent(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions, http.MethodPut, http.MethodDelete:
+		return true
+	}
+	return false
+}
+
+// Wait polls the daemon every interval until its API answers or ctx is
+// done. Error responses count as an answer, except for server errors.
+func (c *Client) Wait(ctx context.Context, interval time.Duration) error {
+	if c.err != nil {
+		return c.err
+	}
+	for {
+		err := c.Do(ctx, http.MethodGet, "/api/v1/groups", nil, nil, nil)
+		if err == nil || !errors.Is(err, ErrConnection) && !errors.Is(err, ErrServer) {
+			return nil
+		}
+
+		timer := time.NewTimer(interval)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return fmt.Errorf("gave up waiting for the daemon: %w", err)
+		case <-timer.C:
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+)
+
+// RulesService wraps the /api/v1/groups/{groupID}/rules endpoints.
+type RulesService struct {
+	c *Client
+}
+
+// List returns all rules of a group.
+func (s *RulesService) List(ctx context.Context, groupID string) ([]types.RuleRes, error) {
+	var res types.RulesRes
+	if err := s.c.Do(ctx, http.MethodGet, rulesPath(groupID), nil, nil, &res); err != nil {
+		return nil, err
+	}
+	if res.Rules == nil {
+		return nil, nil
+	}
+	return *res.Rules, nil
+}
+
+// Replace replaces all rules of a group. Rules with an ID keep it, the
+// others get a new one.
+func (s *RulesService) Replace(ctx context.Context, groupID string, rules []types.RuleReq, save bool) ([]types.RuleRes, error) {
+	var res types.RulesRes
+	req := types.RulesReq{Rules: &rules}
+	if err := s.c.Do(ctx, http.MethodPut, rulesPath(groupID), saveQuery(save), req, &res); err != nil {
+		return nil, err
+	}
+	if res.Rules == nil {
+		return nil, nil
+	}
+	return *res.Rules, nil
+}
+
+// Create appends a single rule to a group.
+func (s *RulesService) Create(ctx context.Context, groupID string, req types.RuleReq, save bool) (*types.RuleRes, error) {
+	var res types.RuleRes
+	if err := s.c.Do(ctx, http.MethodPost, rulesPath(groupID), saveQuery(save), req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Get returns a single rule.
+func (s *RulesService) Get(ctx context.Context, groupID, ruleID string) (*types.RuleRes, error) {
+	var res types.RuleRes
+	if err := s.c.Do(ctx, http.MethodGet, rulePath(groupID, ruleID), nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Update replaces all fields of a single rule.
+func (s *RulesService) Update(ctx context.Context, groupID, ruleID string, req types.RuleReq, save bool) (*types.RuleRes, error) {
+	var res types.RuleRes
+	if err := s.c.Do(ctx, http.MethodPut, rulePath(groupID, ruleID), saveQuery(save), req, &res); err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// Delete removes a single rule.
+func (s *RulesService) Delete(ctx context.Context, groupID, ruleID string, save bool) error {
+	return s.c.Do(ctx, http.MethodDelete, rulePath(groupID, ruleID), saveQuery(save), nil, nil)
+}
+
+func rulesPath(groupID string) string {
+	return groupPath(groupID) + "/rules"
+}
+
+func rulePath(groupID, ruleID string) string {
+	return rulesPath(groupID) + "/" + url.PathEscape(ruleID)
+}
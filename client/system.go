@@ -0,0 +1,36 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+)
+
+// SystemService wraps the /api/v1/system endpoints.
+type SystemService struct {
+	c *Client
+}
+
+// NetfilterDHook triggers a netfilter.d hook on the daemon.
+func (s *SystemService) NetfilterDHook(ctx context.Context, hookType, table string) error {
+	req := types.NetfilterDHookReq{
+		Type:  hookType,
+		Table: table,
+	}
+	return s.c.Do(ctx, http.MethodPost, "/api/v1/system/hooks/netfilterd", nil, req, nil)
+}
+
+// Interfaces lists the network interfaces known to the daemon.
+func (s *SystemService) Interfaces(ctx context.Context) ([]types.InterfaceRes, error) {
+	var res types.InterfacesRes
+	if err := s.c.Do(ctx, http.MethodGet, "/api/v1/system/interfaces", nil, nil, &res); err != nil {
+		return nil, err
+	}
+	return res.Interfaces, nil
+}
+
+// SaveConfig persists the running configuration.
+func (s *SystemService) SaveConfig(ctx context.Context) error {
+	return s.c.Do(ctx, http.MethodPost, "/api/v1/system/config/save", nil, nil, nil)
+}
@@ -0,0 +1,362 @@
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"magitrickle-cli/constant"
+)
+
+// Verbosity levels of Options.Verbosity.
+const (
+	// LogRequests logs the method, URL, status and latency of every request.
+	LogRequests = 1
+	// LogBodies also logs the request and response bodies.
+	LogBodies = 2
+	// LogHeaders also logs the headers.
+	LogHeaders = 3
+)
+
+const redacted = "[REDACTED]"
+
+// sensitiveHeaders are redacted in logs and traces.
+var sensitiveHeaders = []string{"Authorization", "Proxy-Authorization", "Cookie", "Set-Cookie"}
+
+// isSensitiveKey reports whether a JSON field or query parameter likely
+// holds a secret.
+func isSensitiveKey(key string) bool {
+	key = strings.ToLower(key)
+	for _, s := range []string{"token", "password", "secret"} {
+		if strings.Contains(key, s) {
+			return true
+		}
+	}
+	return false
+}
+
+func redactHeaders(h http.Header) http.Header {
+	h = h.Clone()
+	for _, name := range sensitiveHeaders {
+		values := h.Values(name)
+		for i, v := range values {
+			// Keep the scheme, it tells basic from bearer authentication.
+			if scheme, _, ok := strings.Cut(v, " "); ok && name != "Cookie" && name != "Set-Cookie" {
+				values[i] = scheme + " " + redacted
+			} else {
+				values[i] = redacted
+			}
+		}
+	}
+	return h
+}
+
+func redactURL(u *url.URL) string {
+	query := u.Query()
+	changed := false
+	for key := range query {
+		if isSensitiveKey(key) {
+			query.Set(key, redacted)
+			changed = true
+		}
+	}
+	if !changed {
+		return u.String()
+	}
+	c := *u
+	c.RawQuery = query.Encode()
+	return c.String()
+}
+
+// redactBody replaces secret fields of a JSON body. Other bodies are
+// returned as they are.
+func redactBody(body []byte) []byte {
+	var v interface{}
+	if len(body) == 0 || json.Unmarshal(body, &v) != nil || !redactJSON(v) {
+		return body
+	}
+	out, err := json.Marshal(v)
+	if err != nil {
+		return body
+	}
+	return out
+}
+
+func redactJSON(v interface{}) bool {
+	changed := false
+	switch v := v.(type) {
+	case map[string]interface{}:
+		for key, value := range v {
+			if _, isString := value.(string); isString && isSensitiveKey(key) {
+				v[key] = redacted
+				changed = true
+			} else if redactJSON(value) {
+				changed = true
+			}
+		}
+	case []interface{}:
+		for _, value := range v {
+			if redactJSON(value) {
+				changed = true
+			}
+		}
+	}
+	return changed
+}
+
+// debugTransport logs and traces the requests of a Client.
+type debugTransport struct {
+	next      http.RoundTripper
+	verbosity int
+	log       io.Writer
+	trace     *Trace
+}
+
+func (t *debugTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	var reqBody []byte
+	if req.Body != nil {
+		var err error
+		if reqBody, err = io.ReadAll(req.Body); err != nil {
+			return nil, err
+		}
+		req.Body.Close()
+		req.Body = io.NopCloser(bytes.NewReader(reqBody))
+	}
+
+	start := time.Now()
+	resp, err := t.next.RoundTrip(req)
+	var respBody []byte
+	if err == nil {
+		respBody, err = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		resp.Body = io.NopCloser(bytes.NewReader(respBody))
+		if err != nil {
+			resp = nil
+		}
+	}
+	elapsed := time.Since(start)
+
+	reqBody, respBody = redactBody(reqBody), redactBody(respBody)
+	if t.verbosity > 0 {
+		t.logExchange(req, reqBody, resp, respBody, err, elapsed)
+	}
+	if t.trace != nil {
+		t.trace.add(req, reqBody, resp, respBody, err, start, elapsed)
+	}
+	return resp, err
+}
+
+func (t *debugTransport) logExchange(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, err error, elapsed time.Duration) {
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s", req.Method, redactURL(req.URL))
+	if err != nil {
+		fmt.Fprintf(&b, " failed after %s: %v\n", elapsed.Round(time.Microsecond), err)
+	} else {
+		fmt.Fprintf(&b, " %s in %s\n", resp.Status, elapsed.Round(time.Microsecond))
+	}
+
+	if t.verbosity >= LogHeaders {
+		writeHeaders(&b, "> ", redactHeaders(req.Header))
+	}
+	if t.verbosity >= LogBodies && len(reqBody) > 0 {
+		writeBody(&b, "> ", reqBody)
+	}
+	if resp != nil {
+		if t.verbosity >= LogHeaders {
+			writeHeaders(&b, "< ", redactHeaders(resp.Header))
+		}
+		if t.verbosity >= LogBodies && len(respBody) > 0 {
+			writeBody(&b, "< ", respBody)
+		}
+	}
+	_, _ = io.WriteString(t.log, b.String())
+}
+
+func writeHeaders(b *strings.Builder, prefix string, h http.Header) {
+	names := make([]string, 0, len(h))
+	for name := range h {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		for _, v := range h[name] {
+			fmt.Fprintf(b, "%s%s: %s\n", prefix, name, v)
+		}
+	}
+}
+
+func writeBody(b *strings.Builder, prefix string, body []byte) {
+	for _, line := range strings.Split(strings.TrimRight(string(body), "\n"), "\n") {
+		b.WriteString(prefix + line + "\n")
+	}
+}
+
+// Trace records every request and response of a Client, with secrets
+// redacted, for bug reports. The zero value is ready to use.
+type Trace struct {
+	mu      sync.Mutex
+	entries []harEntry
+}
+
+// WriteHAR writes the recorded exchanges as an HTTP Archive (HAR 1.2).
+// Failed requests have a zero status and the error in "_error".
+func (t *Trace) WriteHAR(w io.Writer) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	doc := harDocument{Log: harLog{
+		Version: "1.2",
+		Creator: harCreator{Name: "magitrickle-cli", Version: constant.Version},
+		Entries: t.entries,
+	}}
+	if doc.Log.Entries == nil {
+		doc.Log.Entries = []harEntry{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(doc)
+}
+
+func (t *Trace) add(req *http.Request, reqBody []byte, resp *http.Response, respBody []byte, err error, start time.Time, elapsed time.Duration) {
+	ms := float64(elapsed) / float64(time.Millisecond)
+	entry := harEntry{
+		StartedDateTime: start,
+		Time:            ms,
+		Request: harRequest{
+			Method:      req.Method,
+			URL:         redactURL(req.URL),
+			HTTPVersion: req.Proto,
+			Headers:     harHeaders(redactHeaders(req.Header)),
+			QueryString: []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    len(reqBody),
+		},
+		Response: harResponse{
+			Headers:     []harNameValue{},
+			HeadersSize: -1,
+			BodySize:    -1,
+		},
+		Cache:   struct{}{},
+		Timings: harTimings{Send: 0, Wait: ms, Receive: 0},
+	}
+	for key, values := range req.URL.Query() {
+		for _, v := range values {
+			if isSensitiveKey(key) {
+				v = redacted
+			}
+			entry.Request.QueryString = append(entry.Request.QueryString, harNameValue{Name: key, Value: v})
+		}
+	}
+	if reqBody != nil {
+		entry.Request.PostData = &harPostData{MimeType: req.Header.Get("Content-Type"), Text: string(reqBody)}
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	} else {
+		entry.Response = harResponse{
+			Status:      resp.StatusCode,
+			StatusText:  http.StatusText(resp.StatusCode),
+			HTTPVersion: resp.Proto,
+			Headers:     harHeaders(redactHeaders(resp.Header)),
+			Content: harContent{
+				Size:     len(respBody),
+				MimeType: resp.Header.Get("Content-Type"),
+				Text:     string(respBody),
+			},
+			HeadersSize: -1,
+			BodySize:    len(respBody),
+		}
+	}
+
+	t.mu.Lock()
+	t.entries = append(t.entries, entry)
+	t.mu.Unlock()
+}
+
+func harHeaders(h http.Header) []harNameValue {
+	headers := []harNameValue{}
+	for name, values := range h {
+		for _, v := range values {
+			headers = append(headers, harNameValue{Name: name, Value: v})
+		}
+	}
+	sort.Slice(headers, func(i, j int) bool { return headers[i].Name < headers[j].Name })
+	return headers
+}
+
+// HAR 1.2 document, see http://www.softwareishard.com/blog/har-12-spec/.
+type harDocument struct {
+	Log harLog `json:"log"`
+}
+
+type harLog struct {
+	Version string     `json:"version"`
+	Creator harCreator `json:"creator"`
+	Entries []harEntry `json:"entries"`
+}
+
+type harCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+type harEntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         harRequest  `json:"request"`
+	Response        harResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         harTimings  `json:"timings"`
+	Error           string      `json:"_error,omitempty"`
+}
+
+type harRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	QueryString []harNameValue `json:"queryString"`
+	PostData    *harPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Headers     []harNameValue `json:"headers"`
+	Content     harContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int            `json:"bodySize"`
+}
+
+type harNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+type harPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+type harContent struct {
+	Size     int    `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+}
+
+type harTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
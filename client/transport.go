@@ -0,0 +1,115 @@
+package client
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+func newUnixTransport(socketPath string) *http.Transport {
+	return &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, "unix", socketPath)
+		},
+	}
+}
+
+func newTCPTransport(tlsConfig *tls.Config) *http.Transport {
+	tr := http.DefaultTransport.(*http.Transport).Clone()
+	tr.TLSClientConfig = tlsConfig
+	return tr
+}
+
+// target is a parsed connection destination.
+type target struct {
+	socketPath string
+	baseURL    string
+}
+
+// parseServer parses a server URL: unix:///path/to.sock, http://host:port or
+// https://host:port (optionally with a path prefix).
+func parseServer(server string) (target, error) {
+	u, err := url.Parse(server)
+	if err != nil {
+		return target{}, fmt.Errorf("invalid server URL %q: %w", server, err)
+	}
+
+	switch u.Scheme {
+	case "unix":
+		path := u.Path
+		if path == "" {
+			path = u.Opaque
+		}
+		if path == "" {
+			return target{}, fmt.Errorf("invalid server URL %q: missing socket path", server)
+		}
+		return target{socketPath: path, baseURL: "http://unix"}, nil
+	case "http", "https":
+		if u.Host == "" {
+			return target{}, fmt.Errorf("invalid server URL %q: missing host", server)
+		}
+		return target{baseURL: u.Scheme + "://" + u.Host + strings.TrimSuffix(u.Path, "/")}, nil
+	default:
+		return target{}, fmt.Errorf("invalid server URL %q: unsupported scheme %q (want unix, http or https)", server, u.Scheme)
+	}
+}
+
+// TLSFiles describes PEM files used to build a TLS configuration.
+type TLSFiles struct {
+	// CAFile is a bundle of CA certificates trusted in addition to the system pool.
+	CAFile string
+	// CertFile and KeyFile are the client certificate and key.
+	CertFile string
+	KeyFile  string
+	// InsecureSkipVerify disables server certificate verification.
+	InsecureSkipVerify bool
+}
+
+// IsZero reports whether no TLS settings were given.
+func (f TLSFiles) IsZero() bool {
+	return f == TLSFiles{}
+}
+
+// TLSConfig loads the files into a *tls.Config.
+func (f TLSFiles) TLSConfig() (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: f.InsecureSkipVerify,
+	}
+
+	if f.CAFile != "" {
+		pem, err := os.ReadFile(f.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil || pool == nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in %s", f.CAFile)
+		}
+		cfg.RootCAs = pool
+	}
+
+	if f.CertFile != "" || f.KeyFile != "" {
+		if f.CertFile == "" || f.KeyFile == "" {
+			return nil, errors.New("both client certificate and key must be specified")
+		}
+		cert, err := tls.LoadX509KeyPair(f.CertFile, f.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
@@ -0,0 +1,7 @@
+// Package constant holds build information injected via -ldflags.
+package constant
+
+var (
+	Version = "0.0.0"
+	Commit  = "unknown"
+)
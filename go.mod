@@ -2,10 +2,15 @@ module magitrickle-cli
 
 go 1.21
 
-require github.com/spf13/cobra v1.9.1
+require (
+	github.com/spf13/cobra v1.9.1
+	github.com/spf13/pflag v1.0.6
+	golang.org/x/net v0.31.0
+	gopkg.in/yaml.v3 v3.0.1
+)
 
 require (
 	github.com/Ponywka/MagiTrickle v0.0.0-20250309062023-e30b480d1d1c // direct
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
-	github.com/spf13/pflag v1.0.6 // indirect
+	golang.org/x/text v0.21.0 // indirect
 )
@@ -0,0 +1,174 @@
+// Package matcher evaluates MagiTrickle rules locally, with the semantics of
+// the daemon, to find out which groups a domain name or IP address belongs
+// to.
+//
+//	m := matcher.New(groups)
+//	for _, match := range m.Domain("www.youtube.com") {
+//		fmt.Println(match.Group, match.Rule.Rule, match.Wins)
+//	}
+//
+// The daemon adds the addresses of a matching name to every enabled group
+// with a matching enabled rule. The first of them in configuration order is
+// reported as the one that wins.
+package matcher
+
+import (
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+
+	"magitrickle-cli/ruleset"
+)
+
+// Match is a rule that matches a name or address.
+type Match struct {
+	GroupID      string        `json:"group_id"`
+	Group        string        `json:"group"`
+	Interface    string        `json:"interface"`
+	GroupEnabled bool          `json:"group_enabled"`
+	Rule         types.RuleRes `json:"rule"`
+	// Active is set when both the rule and its group are enabled.
+	Active bool `json:"active"`
+	// Wins marks the first active match.
+	Wins bool `json:"wins"`
+}
+
+// Matcher matches names and addresses against a set of groups. It is safe
+// for concurrent use.
+type Matcher struct {
+	groups []types.GroupRes
+	// regexes holds the compiled regex rules; invalid ones are nil and
+	// never match, as in the daemon.
+	regexes map[string]*regexp.Regexp
+}
+
+// New creates a Matcher for groups, which must include their rules.
+func New(groups []types.GroupRes) *Matcher {
+	m := &Matcher{groups: groups, regexes: make(map[string]*regexp.Regexp)}
+	for _, g := range groups {
+		if g.Rules == nil {
+			continue
+		}
+		for _, r := range *g.Rules {
+			if r.Type == ruleset.TypeRegex {
+				if _, ok := m.regexes[r.Rule]; !ok {
+					re, _ := regexp.Compile(r.Rule)
+					m.regexes[r.Rule] = re
+				}
+			}
+		}
+	}
+	return m
+}
+
+// Domain returns the domain rules matching name, in configuration order.
+// name is compared as given; the daemon sees lowercase names without the
+// trailing dot.
+func (m *Matcher) Domain(name string) []Match {
+	return m.collect(func(r types.RuleRes) bool { return m.MatchRule(r, name) })
+}
+
+// IP returns the subnet and subnet6 rules containing addr, in
+// configuration order.
+func (m *Matcher) IP(addr netip.Addr) []Match {
+	addr = addr.Unmap()
+	return m.collect(func(r types.RuleRes) bool { return MatchSubnet(r, addr) })
+}
+
+func (m *Matcher) collect(match func(types.RuleRes) bool) []Match {
+	var matches []Match
+	won := false
+	for _, g := range m.groups {
+		if g.Rules == nil {
+			continue
+		}
+		for _, r := range *g.Rules {
+			if !match(r) {
+				continue
+			}
+			active := g.Enable && r.Enable
+			matches = append(matches, Match{
+				GroupID:      g.ID.String(),
+				Group:        g.Name,
+				Interface:    g.Interface,
+				GroupEnabled: g.Enable,
+				Rule:         r,
+				Active:       active,
+				Wins:         active && !won,
+			})
+			won = won || active
+		}
+	}
+	return matches
+}
+
+// MatchRule reports whether the domain rule r matches name. Subnet rules
+// and unknown types never match a name.
+func (m *Matcher) MatchRule(r types.RuleRes, name string) bool {
+	switch r.Type {
+	case ruleset.TypeDomain:
+		return name == r.Rule
+	case ruleset.TypeNamespace:
+		return name == r.Rule || strings.HasSuffix(name, "."+r.Rule)
+	case ruleset.TypeWildcard:
+		return Wildcard(r.Rule, name)
+	case ruleset.TypeRegex:
+		re, ok := m.regexes[r.Rule]
+		if !ok {
+			re, _ = regexp.Compile(r.Rule)
+		}
+		return re != nil && re.MatchString(name)
+	}
+	return false
+}
+
+// MatchSubnet reports whether the subnet or subnet6 rule r contains addr.
+func MatchSubnet(r types.RuleRes, addr netip.Addr) bool {
+	if r.Type != ruleset.TypeSubnet && r.Type != ruleset.TypeSubnet6 {
+		return false
+	}
+	prefix, err := netip.ParsePrefix(r.Rule)
+	if err != nil {
+		// Single addresses are accepted by the API as well.
+		a, err := netip.ParseAddr(r.Rule)
+		return err == nil && a.Unmap() == addr
+	}
+	return prefix.Masked().Contains(addr)
+}
+
+// Wildcard matches name against a wildcard pattern like the daemon does:
+// * matches any sequence of characters, including dots, ? matches one
+// character or none, and . matches exactly one character.
+func Wildcard(pattern, name string) bool {
+	// match[j] reports whether the pattern so far matches name[:j].
+	match := make([]bool, len(name)+1)
+	next := make([]bool, len(name)+1)
+	match[0] = true
+	for i := 0; i < len(pattern); i++ {
+		next[0] = false
+		switch pattern[i] {
+		case '*':
+			next[0] = match[0]
+			for j := 1; j < len(next); j++ {
+				next[j] = match[j] || next[j-1]
+			}
+		case '?':
+			next[0] = match[0]
+			for j := 1; j < len(next); j++ {
+				next[j] = match[j] || match[j-1]
+			}
+		case '.':
+			for j := 1; j < len(next); j++ {
+				next[j] = match[j-1]
+			}
+		default:
+			for j := 1; j < len(next); j++ {
+				next[j] = match[j-1] && name[j-1] == pattern[i]
+			}
+		}
+		match, next = next, match
+	}
+	return match[len(name)]
+}
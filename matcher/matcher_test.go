@@ -0,0 +1,164 @@
+package matcher
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+)
+
+func TestWildcard(t *testing.T) {
+	tests := []struct {
+		pattern, name string
+		want          bool
+	}{
+		{"*", "", true},
+		{"*", "example.com", true},
+		{"*.example.com", "www.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"ads*", "ads.tracker.net", true},
+		{"*youtube*", "www.youtube.com", true},
+		{"*youtube*", "youtu.be", false},
+		{"exampl?.com", "example.com", true},
+		{"exampl?.com", "exampl.com", true},
+		{"exampl?.com", "examplee.com", false},
+		{"a?b", "ab", true},
+		{"a?b", "axb", true},
+		{"a?b", "axxb", false},
+		{"example.com", "example.com", true},
+		{"example.com", "examplexcom", true},
+		{"example.com", "examplecom", false},
+		{"example.com", "example..com", false},
+		{"", "", true},
+		{"", "a", false},
+	}
+	for _, tt := range tests {
+		if got := Wildcard(tt.pattern, tt.name); got != tt.want {
+			t.Errorf("Wildcard(%q, %q) = %v, want %v", tt.pattern, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchRule(t *testing.T) {
+	tests := []struct {
+		typ, rule, name string
+		want            bool
+	}{
+		{"domain", "example.com", "example.com", true},
+		{"domain", "example.com", "www.example.com", false},
+		{"namespace", "example.com", "example.com", true},
+		{"namespace", "example.com", "www.example.com", true},
+		{"namespace", "example.com", "a.b.example.com", true},
+		{"namespace", "example.com", "xexample.com", false},
+		{"namespace", "example.com", "example.com.evil.net", false},
+		{"wildcard", "*.example.com", "www.example.com", true},
+		{"wildcard", "*.example.com", "example.com", false},
+		{"regex", `^ads\d+\.`, "ads1.example.com", true},
+		{"regex", `example`, "www.example.com", true},
+		{"regex", `^example$`, "www.example.com", false},
+		{"regex", `(`, "(", false},
+		{"subnet", "192.0.2.0/24", "192.0.2.1", false},
+		{"unknown", "example.com", "example.com", false},
+	}
+	for _, tt := range tests {
+		r := types.RuleRes{Type: tt.typ, Rule: tt.rule}
+		m := New([]types.GroupRes{{RulesRes: types.RulesRes{Rules: &[]types.RuleRes{r}}}})
+		if got := m.MatchRule(r, tt.name); got != tt.want {
+			t.Errorf("MatchRule(%s %q, %q) = %v, want %v", tt.typ, tt.rule, tt.name, got, tt.want)
+		}
+		// Rules unknown to the Matcher are compiled on the fly.
+		if got := New(nil).MatchRule(r, tt.name); got != tt.want {
+			t.Errorf("uncached MatchRule(%s %q, %q) = %v, want %v", tt.typ, tt.rule, tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMatchSubnet(t *testing.T) {
+	tests := []struct {
+		typ, rule, addr string
+		want            bool
+	}{
+		{"subnet", "192.0.2.0/24", "192.0.2.10", true},
+		{"subnet", "192.0.2.0/24", "192.0.3.10", false},
+		{"subnet", "192.0.2.7/24", "192.0.2.200", true},
+		{"subnet", "192.0.2.1", "192.0.2.1", true},
+		{"subnet", "192.0.2.1", "192.0.2.2", false},
+		{"subnet", "192.0.2.0/24", "::ffff:192.0.2.10", true},
+		{"subnet6", "2001:db8::/32", "2001:db8:1::1", true},
+		{"subnet6", "2001:db8::/32", "2001:db9::1", false},
+		{"subnet6", "2001:db8::/32", "192.0.2.10", false},
+		{"subnet", "not-a-subnet", "192.0.2.10", false},
+		{"domain", "192.0.2.0/24", "192.0.2.10", false},
+		{"namespace", "192.0.2.10", "192.0.2.10", false},
+	}
+	for _, tt := range tests {
+		r := types.RuleRes{Type: tt.typ, Rule: tt.rule}
+		addr := netip.MustParseAddr(tt.addr)
+		got := New([]types.GroupRes{{RulesRes: types.RulesRes{Rules: &[]types.RuleRes{r}}}}).IP(addr)
+		if (len(got) == 1) != tt.want {
+			t.Errorf("IP(%s) with %s %q: %d matches, want match %v", tt.addr, tt.typ, tt.rule, len(got), tt.want)
+		}
+		if got := MatchSubnet(r, addr.Unmap()); got != tt.want {
+			t.Errorf("MatchSubnet(%s %q, %s) = %v, want %v", tt.typ, tt.rule, tt.addr, got, tt.want)
+		}
+	}
+}
+
+func TestWins(t *testing.T) {
+	rule := func(id byte, enable bool) types.RuleRes {
+		return types.RuleRes{ID: types.ID{id}, Type: "namespace", Rule: "example.com", Enable: enable}
+	}
+	group := func(id byte, enable bool, rules ...types.RuleRes) types.GroupRes {
+		return types.GroupRes{ID: types.ID{id}, Name: string(rune('A' + id)), Enable: enable, RulesRes: types.RulesRes{Rules: &rules}}
+	}
+
+	tests := []struct {
+		name   string
+		groups []types.GroupRes
+		// wins is the index of the winning match, -1 for none.
+		wins    int
+		matches int
+	}{
+		{
+			name:    "first enabled",
+			groups:  []types.GroupRes{group(0, true, rule(1, true)), group(1, true, rule(2, true))},
+			wins:    0,
+			matches: 2,
+		},
+		{
+			name:    "disabled rule before enabled one",
+			groups:  []types.GroupRes{group(0, true, rule(1, false), rule(2, true)), group(1, true, rule(3, true))},
+			wins:    1,
+			matches: 3,
+		},
+		{
+			name:    "disabled group before enabled one",
+			groups:  []types.GroupRes{group(0, false, rule(1, true)), group(1, true, rule(2, true))},
+			wins:    1,
+			matches: 2,
+		},
+		{
+			name:    "only disabled",
+			groups:  []types.GroupRes{group(0, false, rule(1, true)), group(1, true, rule(2, false))},
+			wins:    -1,
+			matches: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			matches := New(tt.groups).Domain("www.example.com")
+			if len(matches) != tt.matches {
+				t.Fatalf("got %d matches, want %d", len(matches), tt.matches)
+			}
+			for i, m := range matches {
+				if m.Wins != (i == tt.wins) {
+					t.Errorf("match %d (group %s, rule %s): Wins = %v", i, m.Group, m.Rule.ID, m.Wins)
+				}
+				if m.Active != (m.GroupEnabled && m.Rule.Enable) {
+					t.Errorf("match %d: Active = %v", i, m.Active)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,338 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+
+	"magitrickle-cli/client"
+)
+
+// Action is what a plan does with an object.
+type Action string
+
+const (
+	ActionCreate    Action = "create"
+	ActionUpdate    Action = "update"
+	ActionDelete    Action = "delete"
+	ActionUnchanged Action = "unchanged"
+)
+
+// FieldChange is a single modified field. From and To are quoted for
+// strings so empty values stay visible.
+type FieldChange struct {
+	Field string
+	From  string
+	To    string
+}
+
+// RuleChange is the planned change of one rule.
+type RuleChange struct {
+	Action Action
+	// Desired is nil for deletions, Live is nil for creations.
+	Desired *Rule
+	Live    *types.RuleRes
+	Fields  []FieldChange
+}
+
+// GroupChange is the planned change of one group and its rules.
+type GroupChange struct {
+	Action  Action
+	Desired *Group
+	Live    *types.GroupRes
+	Fields  []FieldChange
+	// Rules is empty when the rules of the group are not managed.
+	Rules []RuleChange
+	// Result is the group as returned by the server once Apply created or
+	// updated it.
+	Result *types.GroupRes
+}
+
+// Name returns the desired name, or the live name for deletions.
+func (c GroupChange) Name() string {
+	if c.Desired != nil {
+		return c.Desired.Name
+	}
+	return c.Live.Name
+}
+
+// rulesChanged reports whether any rule is created, updated or deleted.
+func (c GroupChange) rulesChanged() bool {
+	for _, r := range c.Rules {
+		if r.Action != ActionUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// Plan is the ordered list of group changes.
+type Plan struct {
+	Groups []GroupChange
+}
+
+// HasChanges reports whether applying the plan would modify anything.
+func (p *Plan) HasChanges() bool {
+	for _, g := range p.Groups {
+		if g.Action != ActionUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// Counts returns the number of groups to create, update and delete.
+func (p *Plan) Counts() (create, update, del int) {
+	for _, g := range p.Groups {
+		switch g.Action {
+		case ActionCreate:
+			create++
+		case ActionUpdate:
+			update++
+		case ActionDelete:
+			del++
+		}
+	}
+	return create, update, del
+}
+
+// NewPlan compares the document with live groups (fetched with rules).
+// Groups are matched by ID, then by name, so a group recreated with a new
+// ID is still found.
+// Live groups missing from the document are deleted only when prune is set.
+func NewPlan(doc *Document, live []types.GroupRes, prune bool) (*Plan, error) {
+	matched := make(map[types.ID]bool)
+	liveFor := make([]*types.GroupRes, len(doc.Groups))
+
+	for i, g := range doc.Groups {
+		if g.ID == "" {
+			continue
+		}
+		for j := range live {
+			if live[j].ID.String() == g.ID {
+				liveFor[i] = &live[j]
+				matched[live[j].ID] = true
+				break
+			}
+		}
+	}
+	for i, g := range doc.Groups {
+		if liveFor[i] != nil {
+			continue
+		}
+		var found []*types.GroupRes
+		for j := range live {
+			if live[j].Name == g.Name && !matched[live[j].ID] {
+				found = append(found, &live[j])
+			}
+		}
+		if len(found) > 1 {
+			if g.ID != "" {
+				return nil, fmt.Errorf("group %q (%s) is not live and matches %d live groups by name", g.Name, g.ID, len(found))
+			}
+			return nil, fmt.Errorf("group %q matches %d live groups by name, add an id to the policy", g.Name, len(found))
+		}
+		if len(found) == 1 {
+			liveFor[i] = found[0]
+			matched[found[0].ID] = true
+		}
+	}
+
+	plan := &Plan{}
+	for i := range doc.Groups {
+		plan.Groups = append(plan.Groups, planGroup(&doc.Groups[i], liveFor[i]))
+	}
+	if prune {
+		for j := range live {
+			if !matched[live[j].ID] {
+				plan.Groups = append(plan.Groups, GroupChange{Action: ActionDelete, Live: &live[j]})
+			}
+		}
+	}
+	return plan, nil
+}
+
+func planGroup(desired *Group, live *types.GroupRes) GroupChange {
+	change := GroupChange{Desired: desired, Live: live}
+	if live == nil {
+		change.Action = ActionCreate
+		if desired.Rules != nil {
+			for i := range *desired.Rules {
+				change.Rules = append(change.Rules, RuleChange{Action: ActionCreate, Desired: &(*desired.Rules)[i]})
+			}
+		}
+		return change
+	}
+
+	change.Fields = appendStringChange(change.Fields, "name", live.Name, desired.Name)
+	change.Fields = appendStringChange(change.Fields, "interface", live.Interface, desired.Interface)
+	if desired.Color != "" {
+		change.Fields = appendStringChange(change.Fields, "color", live.Color, desired.Color)
+	}
+	change.Fields = appendBoolChange(change.Fields, "enable", live.Enable, desired.Enabled())
+
+	if desired.Rules != nil {
+		var liveRules []types.RuleRes
+		if live.Rules != nil {
+			liveRules = *live.Rules
+		}
+		change.Rules = planRules(*desired.Rules, liveRules)
+	}
+
+	change.Action = ActionUnchanged
+	if len(change.Fields) > 0 || change.rulesChanged() {
+		change.Action = ActionUpdate
+	}
+	return change
+}
+
+// planRules matches rules by ID, then by name, then by type and value.
+func planRules(desired []Rule, live []types.RuleRes) []RuleChange {
+	matched := make([]bool, len(live))
+	liveFor := make([]int, len(desired))
+	for i := range liveFor {
+		liveFor[i] = -1
+	}
+
+	match := func(pred func(d Rule, l types.RuleRes) bool) {
+		for i, d := range desired {
+			if liveFor[i] >= 0 {
+				continue
+			}
+			for j, l := range live {
+				if !matched[j] && pred(d, l) {
+					liveFor[i] = j
+					matched[j] = true
+					break
+				}
+			}
+		}
+	}
+	match(func(d Rule, l types.RuleRes) bool { return d.ID != "" && d.ID == l.ID.String() })
+	match(func(d Rule, l types.RuleRes) bool { return d.Name != "" && d.Name == l.Name })
+	match(func(d Rule, l types.RuleRes) bool { return d.RuleType() == l.Type && d.Rule == l.Rule })
+
+	var changes []RuleChange
+	for i := range desired {
+		d := &desired[i]
+		if liveFor[i] < 0 {
+			changes = append(changes, RuleChange{Action: ActionCreate, Desired: d})
+			continue
+		}
+
+		l := &live[liveFor[i]]
+		c := RuleChange{Desired: d, Live: l, Action: ActionUnchanged}
+		c.Fields = appendStringChange(c.Fields, "name", l.Name, d.Name)
+		c.Fields = appendStringChange(c.Fields, "type", l.Type, d.RuleType())
+		c.Fields = appendStringChange(c.Fields, "rule", l.Rule, d.Rule)
+		c.Fields = appendBoolChange(c.Fields, "enable", l.Enable, d.Enabled())
+		if len(c.Fields) > 0 {
+			c.Action = ActionUpdate
+		}
+		changes = append(changes, c)
+	}
+	for j := range live {
+		if !matched[j] {
+			changes = append(changes, RuleChange{Action: ActionDelete, Live: &live[j]})
+		}
+	}
+	return changes
+}
+
+func appendStringChange(changes []FieldChange, field, from, to string) []FieldChange {
+	if from == to {
+		return changes
+	}
+	return append(changes, FieldChange{Field: field, From: strconv.Quote(from), To: strconv.Quote(to)})
+}
+
+func appendBoolChange(changes []FieldChange, field string, from, to bool) []FieldChange {
+	if from == to {
+		return changes
+	}
+	return append(changes, FieldChange{Field: field, From: strconv.FormatBool(from), To: strconv.FormatBool(to)})
+}
+
+// Apply executes the plan: deletions first, then updates and creations in
+// document order. With save the configuration is persisted once at the end.
+func (p *Plan) Apply(ctx context.Context, c *client.Client, save bool) error {
+	for _, g := range p.Groups {
+		if g.Action != ActionDelete {
+			continue
+		}
+		if err := c.Groups().Delete(ctx, g.Live.ID.String(), false); err != nil {
+			return fmt.Errorf("delete group %q: %w", g.Name(), err)
+		}
+	}
+
+	for i, g := range p.Groups {
+		var err error
+		switch g.Action {
+		case ActionCreate:
+			if p.Groups[i].Result, err = c.Groups().Create(ctx, g.groupReq(), false); err != nil {
+				return fmt.Errorf("create group %q: %w", g.Name(), err)
+			}
+		case ActionUpdate:
+			if p.Groups[i].Result, err = c.Groups().Update(ctx, g.Live.ID.String(), g.groupReq(), false); err != nil {
+				return fmt.Errorf("update group %q: %w", g.Name(), err)
+			}
+		}
+	}
+
+	if save && p.HasChanges() {
+		if err := c.System().SaveConfig(ctx); err != nil {
+			return fmt.Errorf("save config: %w", err)
+		}
+	}
+	return nil
+}
+
+// groupReq builds the request for a create or update. Rules are only sent
+// when they are managed and changed, so the server keeps them otherwise.
+func (c GroupChange) groupReq() types.GroupReq {
+	d := c.Desired
+	enable := d.Enabled()
+	req := types.GroupReq{
+		Name:      d.Name,
+		Interface: d.Interface,
+		Color:     d.Color,
+		Enable:    &enable,
+	}
+
+	if c.Live != nil {
+		if req.Color == "" {
+			req.Color = c.Live.Color
+		}
+		id := c.Live.ID
+		req.ID = &id
+	} else if d.ID != "" {
+		id, _ := types.ParseID(d.ID)
+		req.ID = &id
+	}
+
+	if d.Rules == nil || (c.Action == ActionUpdate && !c.rulesChanged()) {
+		return req
+	}
+
+	rules := make([]types.RuleReq, 0, len(*d.Rules))
+	for _, rc := range c.Rules {
+		if rc.Action == ActionDelete {
+			continue
+		}
+		r := types.RuleReq{
+			Name:   rc.Desired.Name,
+			Type:   rc.Desired.RuleType(),
+			Rule:   rc.Desired.Rule,
+			Enable: rc.Desired.Enabled(),
+		}
+		if rc.Live != nil {
+			id := rc.Live.ID
+			r.ID = &id
+		}
+		rules = append(rules, r)
+	}
+	req.Rules = &rules
+	return req
+}
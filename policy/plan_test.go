@@ -0,0 +1,209 @@
+package policy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+)
+
+func liveGroup(id byte, name string, rules ...types.RuleRes) types.GroupRes {
+	return types.GroupRes{ID: types.ID{id}, Name: name, Interface: "nwg0", Enable: true, RulesRes: types.RulesRes{Rules: &rules}}
+}
+
+func liveRule(id byte, name, typ, rule string) types.RuleRes {
+	return types.RuleRes{ID: types.ID{id}, Name: name, Type: typ, Rule: rule, Enable: true}
+}
+
+func TestNewPlanRecreatedGroup(t *testing.T) {
+	// A backup taken before the group was deleted and created again.
+	backup := FromGroups([]types.GroupRes{liveGroup(1, "VPN", liveRule(1, "", "namespace", "example.com"))})
+	live := []types.GroupRes{liveGroup(2, "VPN", liveRule(2, "", "namespace", "example.com"))}
+
+	plan, err := NewPlan(backup, live, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(plan.Groups) != 1 {
+		t.Fatalf("got %d group changes, want 1", len(plan.Groups))
+	}
+	g := plan.Groups[0]
+	if g.Live == nil || g.Live.ID != (types.ID{2}) {
+		t.Fatalf("group not matched by name: action %s", g.Action)
+	}
+	if g.Action != ActionUnchanged || plan.HasChanges() {
+		t.Errorf("action = %s, want %s", g.Action, ActionUnchanged)
+	}
+}
+
+func TestNewPlanGroups(t *testing.T) {
+	enabled := true
+	live := []types.GroupRes{
+		liveGroup(1, "VPN"),
+		liveGroup(2, "Ads"),
+		liveGroup(3, "Dup"),
+		liveGroup(4, "Dup"),
+	}
+	group := func(id, name string) Group {
+		return Group{ID: id, Name: name, Interface: "nwg0", Enable: &enabled}
+	}
+
+	tests := []struct {
+		name  string
+		doc   []Group
+		prune bool
+		// want is the action and matched live ID (0 for none) per change.
+		want    []string
+		wantErr string
+	}{
+		{
+			name: "no-op",
+			doc:  []Group{group("", "VPN"), group("", "Ads")},
+			want: []string{"unchanged 01", "unchanged 02"},
+		},
+		{
+			name: "id before name",
+			// The second entry would match group 1 by name, which is
+			// already taken by ID.
+			doc:  []Group{group("", "VPN"), group(types.ID{1}.String(), "Renamed")},
+			want: []string{"create", "update 01"},
+		},
+		{
+			name: "unknown id falls back to name",
+			doc:  []Group{group(types.ID{9}.String(), "Ads")},
+			want: []string{"unchanged 02"},
+		},
+		{
+			name:    "ambiguous name",
+			doc:     []Group{group("", "Dup")},
+			wantErr: `group "Dup" matches 2 live groups by name`,
+		},
+		{
+			name: "ambiguous name resolved by id",
+			doc:  []Group{group(types.ID{3}.String(), "Dup"), group("", "Dup")},
+			want: []string{"unchanged 03", "unchanged 04"},
+		},
+		{
+			name:  "prune",
+			doc:   []Group{group("", "VPN"), group(types.ID{3}.String(), "Dup")},
+			prune: true,
+			want:  []string{"unchanged 01", "unchanged 03", "delete 02", "delete 04"},
+		},
+		{
+			name: "no prune",
+			doc:  []Group{group("", "New")},
+			want: []string{"create"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			plan, err := NewPlan(&Document{Groups: tt.doc}, live, tt.prune)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, g := range plan.Groups {
+				s := string(g.Action)
+				if g.Live != nil {
+					s += " " + g.Live.ID.String()[:2]
+				}
+				got = append(got, s)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("plan = %q, want %q", got, tt.want)
+			}
+			changes := false
+			for _, g := range got {
+				changes = changes || !strings.HasPrefix(g, "unchanged")
+			}
+			if plan.HasChanges() != changes {
+				t.Errorf("HasChanges = %v, want %v", plan.HasChanges(), changes)
+			}
+		})
+	}
+}
+
+func TestPlanRules(t *testing.T) {
+	live := []types.RuleRes{
+		liveRule(1, "", "domain", "a.example"),
+		liveRule(2, "named", "domain", "b.example"),
+		liveRule(3, "", "namespace", "c.example"),
+		liveRule(4, "", "domain", "d.example"),
+	}
+	disabled := false
+
+	tests := []struct {
+		name    string
+		desired []Rule
+		want    []string
+	}{
+		{
+			name: "no-op",
+			desired: []Rule{
+				{Rule: "a.example"},
+				{Name: "named", Rule: "b.example"},
+				{Type: "namespace", Rule: "c.example"},
+				{Type: "domain", Rule: "d.example"},
+			},
+			want: []string{"unchanged 01", "unchanged 02", "unchanged 03", "unchanged 04"},
+		},
+		{
+			name: "id",
+			desired: []Rule{
+				{Type: "domain", Rule: "d.example"},
+				{ID: types.ID{4}.String(), Rule: "changed.example"},
+			},
+			// The first rule does not take rule 4 away from the ID match.
+			want: []string{"create", "update 04 rule", "delete 01", "delete 02", "delete 03"},
+		},
+		{
+			name: "name before value",
+			desired: []Rule{
+				{Rule: "b.example"},
+				{Name: "named", Rule: "renamed.example", Enable: &disabled},
+			},
+			want: []string{"create", "update 02 rule,enable", "delete 01", "delete 03", "delete 04"},
+		},
+		{
+			name: "type and value",
+			desired: []Rule{
+				{Type: "domain", Rule: "c.example"},
+				{Name: "new", Type: "namespace", Rule: "c.example"},
+			},
+			want: []string{"create", "update 03 name", "delete 01", "delete 02", "delete 04"},
+		},
+		{
+			name: "empty",
+			want: []string{"delete 01", "delete 02", "delete 03", "delete 04"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, c := range planRules(tt.desired, live) {
+				s := string(c.Action)
+				if c.Live != nil {
+					s += " " + c.Live.ID.String()[:2]
+				}
+				var fields []string
+				for _, f := range c.Fields {
+					fields = append(fields, f.Field)
+				}
+				if len(fields) > 0 {
+					s += " " + strings.Join(fields, ",")
+				}
+				got = append(got, s)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("changes = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,172 @@
+// Package policy describes the desired MagiTrickle groups and rules as a
+// document and computes the changes needed to reach it from a live state.
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Document is a policy file. JSON documents are accepted as well.
+type Document struct {
+	Groups []Group `yaml:"groups" json:"groups"`
+}
+
+// Group is the desired state of one group.
+type Group struct {
+	// ID is optional; without it, or when no live group has it, the group
+	// is matched by name.
+	ID        string `yaml:"id,omitempty" json:"id,omitempty"`
+	Name      string `yaml:"name" json:"name"`
+	Interface string `yaml:"interface" json:"interface"`
+	// Color is left unchanged when empty.
+	Color string `yaml:"color,omitempty" json:"color,omitempty"`
+	// Enable defaults to true.
+	Enable *bool `yaml:"enable,omitempty" json:"enable,omitempty"`
+	// Rules is the complete list of rules of the group. When the key is
+	// absent the rules of the group are not managed.
+	Rules *[]Rule `yaml:"rules,omitempty" json:"rules,omitempty"`
+}
+
+// Rule is the desired state of one rule.
+type Rule struct {
+	// ID is optional; without it the rule is matched by name, or by type
+	// and value for unnamed rules.
+	ID   string `yaml:"id,omitempty" json:"id,omitempty"`
+	Name string `yaml:"name,omitempty" json:"name,omitempty"`
+	// Type defaults to "domain".
+	Type string `yaml:"type,omitempty" json:"type,omitempty"`
+	Rule string `yaml:"rule" json:"rule"`
+	// Enable defaults to true.
+	Enable *bool `yaml:"enable,omitempty" json:"enable,omitempty"`
+}
+
+// Enabled returns the effective enable flag.
+func (g Group) Enabled() bool {
+	return g.Enable == nil || *g.Enable
+}
+
+// Enabled returns the effective enable flag.
+func (r Rule) Enabled() bool {
+	return r.Enable == nil || *r.Enable
+}
+
+// RuleType returns the effective rule type.
+func (r Rule) RuleType() string {
+	if r.Type == "" {
+		return "domain"
+	}
+	return r.Type
+}
+
+// Load parses and validates a policy document.
+func Load(r io.Reader) (*Document, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var doc Document
+	dec := yaml.NewDecoder(bytes.NewReader(content))
+	dec.KnownFields(true)
+	if err := dec.Decode(&doc); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("failed to parse policy: %w", err)
+	}
+	if err := doc.Validate(); err != nil {
+		return nil, err
+	}
+	// The daemon only accepts lowercase colors and resets anything else.
+	for i := range doc.Groups {
+		doc.Groups[i].Color = strings.ToLower(doc.Groups[i].Color)
+	}
+	return &doc, nil
+}
+
+// Validate checks the document for missing fields and duplicates.
+func (d *Document) Validate() error {
+	names := make(map[string]bool)
+	ids := make(map[string]bool)
+	for i, g := range d.Groups {
+		where := fmt.Sprintf("groups[%d]", i)
+		if g.Name == "" {
+			return fmt.Errorf("%s: name is required", where)
+		}
+		where = fmt.Sprintf("group %q", g.Name)
+		if names[g.Name] {
+			return fmt.Errorf("%s: duplicate group name", where)
+		}
+		names[g.Name] = true
+		if g.Interface == "" {
+			return fmt.Errorf("%s: interface is required", where)
+		}
+		if g.ID != "" {
+			if _, err := types.ParseID(g.ID); err != nil {
+				return fmt.Errorf("%s: invalid id %q", where, g.ID)
+			}
+			if ids[g.ID] {
+				return fmt.Errorf("%s: duplicate group id %q", where, g.ID)
+			}
+			ids[g.ID] = true
+		}
+		if g.Rules == nil {
+			continue
+		}
+
+		ruleIDs := make(map[string]bool)
+		for j, r := range *g.Rules {
+			ruleWhere := fmt.Sprintf("%s: rules[%d]", where, j)
+			if r.Rule == "" {
+				return fmt.Errorf("%s: rule is required", ruleWhere)
+			}
+			if r.ID != "" {
+				if _, err := types.ParseID(r.ID); err != nil {
+					return fmt.Errorf("%s: invalid id %q", ruleWhere, r.ID)
+				}
+				if ruleIDs[r.ID] {
+					return fmt.Errorf("%s: duplicate rule id %q", ruleWhere, r.ID)
+				}
+				ruleIDs[r.ID] = true
+			}
+		}
+	}
+	return nil
+}
+
+// FromGroups builds a document describing live groups exactly, including
+// IDs, so that applying it restores them.
+func FromGroups(groups []types.GroupRes) *Document {
+	doc := &Document{Groups: make([]Group, 0, len(groups))}
+	for _, g := range groups {
+		enable := g.Enable
+		group := Group{
+			ID:        g.ID.String(),
+			Name:      g.Name,
+			Interface: g.Interface,
+			Color:     g.Color,
+			Enable:    &enable,
+		}
+		if g.Rules != nil {
+			rules := make([]Rule, 0, len(*g.Rules))
+			for _, r := range *g.Rules {
+				ruleEnable := r.Enable
+				rules = append(rules, Rule{
+					ID:     r.ID.String(),
+					Name:   r.Name,
+					Type:   r.Type,
+					Rule:   r.Rule,
+					Enable: &ruleEnable,
+				})
+			}
+			group.Rules = &rules
+		}
+		doc.Groups = append(doc.Groups, group)
+	}
+	return doc
+}
@@ -0,0 +1,251 @@
+// Package resolver looks up domain names against a specific DNS server and
+// reports every step of the CNAME chain, which the standard library
+// resolver hides.
+package resolver
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand"
+	"net"
+	"net/netip"
+	"os"
+	"strings"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+// DefaultTimeout is used when Resolver.Timeout is zero.
+const DefaultTimeout = 5 * time.Second
+
+// maxChain limits the length of a CNAME chain.
+const maxChain = 16
+
+// ErrNotFound is returned for names that do not exist (NXDOMAIN).
+var ErrNotFound = errors.New("no such domain")
+
+// Resolver queries one DNS server.
+type Resolver struct {
+	// Server is the address of the DNS server, host or host:port. Defaults
+	// to the first nameserver of /etc/resolv.conf.
+	Server string
+	// Timeout limits every query. Defaults to DefaultTimeout.
+	Timeout time.Duration
+}
+
+// Step is one name of a CNAME chain.
+type Step struct {
+	Name string `json:"name"`
+	// CNAME is the name this one is an alias for; empty for the last step.
+	CNAME string `json:"cname,omitempty"`
+	// Addrs are the A and AAAA records of the last step.
+	Addrs []netip.Addr `json:"addresses,omitempty"`
+}
+
+// Address returns the server address with the port, as queried.
+func (r *Resolver) Address() string {
+	server := r.Server
+	if server == "" {
+		server = DefaultServer()
+	}
+	if addr, err := netip.ParseAddr(strings.Trim(server, "[]")); err == nil {
+		return netip.AddrPortFrom(addr, 53).String()
+	}
+	if _, _, err := net.SplitHostPort(server); err != nil {
+		return net.JoinHostPort(server, "53")
+	}
+	return server
+}
+
+// DefaultServer returns the first nameserver of /etc/resolv.conf, or
+// 127.0.0.1.
+func DefaultServer() string {
+	f, err := os.Open("/etc/resolv.conf")
+	if err != nil {
+		return "127.0.0.1"
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) >= 2 && fields[0] == "nameserver" {
+			return fields[1]
+		}
+	}
+	return "127.0.0.1"
+}
+
+// Resolve looks up the A and AAAA records of name and returns the CNAME
+// chain leading to them, starting with name itself. Names are lowercase
+// and without the trailing dot.
+func (r *Resolver) Resolve(ctx context.Context, name string) ([]Step, error) {
+	name = canonical(name)
+	var chain []Step
+	seen := map[string]bool{name: true}
+	current := name
+	for queries := 0; queries < maxChain; queries++ {
+		cnames, addrs, err := r.lookup(ctx, current)
+		if err != nil {
+			if len(chain) > 0 {
+				return chain, fmt.Errorf("%s: %w", current, err)
+			}
+			return nil, err
+		}
+
+		// The answer usually carries the whole chain; follow it as far as
+		// it goes and query again where it stops.
+		queried := current
+		for {
+			target, ok := cnames[current]
+			if !ok {
+				break
+			}
+			chain = append(chain, Step{Name: current, CNAME: target})
+			if seen[target] || len(chain) >= maxChain {
+				return chain, fmt.Errorf("CNAME loop at %s", target)
+			}
+			seen[target] = true
+			current = target
+		}
+		if current == queried || len(addrs[current]) > 0 {
+			return append(chain, Step{Name: current, Addrs: addrs[current]}), nil
+		}
+	}
+	return chain, errors.New("CNAME chain too long")
+}
+
+// lookup queries A and AAAA records of name.
+func (r *Resolver) lookup(ctx context.Context, name string) (map[string]string, map[string][]netip.Addr, error) {
+	cnames := make(map[string]string)
+	addrs := make(map[string][]netip.Addr)
+	notFound := 0
+	for _, qtype := range []dnsmessage.Type{dnsmessage.TypeA, dnsmessage.TypeAAAA} {
+		msg, err := r.exchange(ctx, name, qtype)
+		if err != nil {
+			return nil, nil, err
+		}
+		switch msg.RCode {
+		case dnsmessage.RCodeSuccess:
+		case dnsmessage.RCodeNameError:
+			notFound++
+			continue
+		default:
+			return nil, nil, fmt.Errorf("server answered %s", strings.TrimPrefix(msg.RCode.String(), "RCode"))
+		}
+
+		for _, rr := range msg.Answers {
+			owner := canonical(rr.Header.Name.String())
+			switch body := rr.Body.(type) {
+			case *dnsmessage.CNAMEResource:
+				cnames[owner] = canonical(body.CNAME.String())
+			case *dnsmessage.AResource:
+				addrs[owner] = appendAddr(addrs[owner], netip.AddrFrom4(body.A))
+			case *dnsmessage.AAAAResource:
+				addrs[owner] = appendAddr(addrs[owner], netip.AddrFrom16(body.AAAA))
+			}
+		}
+	}
+	if notFound == 2 {
+		return nil, nil, ErrNotFound
+	}
+	return cnames, addrs, nil
+}
+
+func appendAddr(addrs []netip.Addr, addr netip.Addr) []netip.Addr {
+	for _, a := range addrs {
+		if a == addr {
+			return addrs
+		}
+	}
+	return append(addrs, addr)
+}
+
+// exchange sends one query over UDP, and again over TCP if the answer was
+// truncated.
+func (r *Resolver) exchange(ctx context.Context, name string, qtype dnsmessage.Type) (*dnsmessage.Message, error) {
+	qname, err := dnsmessage.NewName(name + ".")
+	if err != nil {
+		return nil, fmt.Errorf("invalid name %q: %w", name, err)
+	}
+	id := uint16(rand.Intn(1 << 16))
+	query := dnsmessage.Message{
+		Header:    dnsmessage.Header{ID: id, RecursionDesired: true},
+		Questions: []dnsmessage.Question{{Name: qname, Type: qtype, Class: dnsmessage.ClassINET}},
+	}
+	packet, err := query.Pack()
+	if err != nil {
+		return nil, err
+	}
+
+	msg, err := r.roundTrip(ctx, "udp", packet)
+	if err == nil && msg.Truncated {
+		msg, err = r.roundTrip(ctx, "tcp", packet)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("query %s %s: %w", strings.TrimPrefix(qtype.String(), "Type"), name, err)
+	}
+	if msg.ID != id {
+		return nil, errors.New("answer does not match the query")
+	}
+	return msg, nil
+}
+
+func (r *Resolver) roundTrip(ctx context.Context, network string, packet []byte) (*dnsmessage.Message, error) {
+	timeout := r.Timeout
+	if timeout == 0 {
+		timeout = DefaultTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, network, r.Address())
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+
+	var answer []byte
+	if network == "tcp" {
+		framed := binary.BigEndian.AppendUint16(nil, uint16(len(packet)))
+		if _, err := conn.Write(append(framed, packet...)); err != nil {
+			return nil, err
+		}
+		var size [2]byte
+		if _, err := io.ReadFull(conn, size[:]); err != nil {
+			return nil, err
+		}
+		answer = make([]byte, binary.BigEndian.Uint16(size[:]))
+		if _, err := io.ReadFull(conn, answer); err != nil {
+			return nil, err
+		}
+	} else {
+		if _, err := conn.Write(packet); err != nil {
+			return nil, err
+		}
+		answer = make([]byte, 65535)
+		n, err := conn.Read(answer)
+		if err != nil {
+			return nil, err
+		}
+		answer = answer[:n]
+	}
+
+	var msg dnsmessage.Message
+	if err := msg.Unpack(answer); err != nil {
+		return nil, fmt.Errorf("invalid answer: %w", err)
+	}
+	return &msg, nil
+}
+
+func canonical(name string) string {
+	return strings.ToLower(strings.TrimSuffix(name, "."))
+}
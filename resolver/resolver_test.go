@@ -0,0 +1,249 @@
+package resolver
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"net/netip"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"golang.org/x/net/dns/dnsmessage"
+)
+
+type record struct {
+	cname string
+	addrs []string
+}
+
+// stub is a DNS server on 127.0.0.1 answering from zone over UDP and TCP.
+type stub struct {
+	zone map[string]record
+	// follow puts the whole CNAME chain into one answer, like a recursive
+	// resolver; otherwise only the record of the queried name is returned.
+	follow bool
+	rcode  dnsmessage.RCode
+	// truncate answers UDP queries with an empty truncated message.
+	truncate bool
+	badID    bool
+
+	addr string
+}
+
+func startStub(t *testing.T, s *stub) string {
+	t.Helper()
+	var pc net.PacketConn
+	var ln net.Listener
+	// TCP must listen on the port the kernel picked for UDP.
+	for i := 0; ; i++ {
+		var err error
+		if pc, err = net.ListenPacket("udp", "127.0.0.1:0"); err != nil {
+			t.Fatal(err)
+		}
+		if ln, err = net.Listen("tcp", pc.LocalAddr().String()); err == nil {
+			break
+		}
+		pc.Close()
+		if i == 10 {
+			t.Fatal(err)
+		}
+	}
+	t.Cleanup(func() {
+		pc.Close()
+		ln.Close()
+	})
+
+	go func() {
+		buf := make([]byte, 512)
+		for {
+			n, from, err := pc.ReadFrom(buf)
+			if err != nil {
+				return
+			}
+			if answer := s.answer(buf[:n], s.truncate); answer != nil {
+				_, _ = pc.WriteTo(answer, from)
+			}
+		}
+	}()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				var size [2]byte
+				if _, err := io.ReadFull(conn, size[:]); err != nil {
+					return
+				}
+				query := make([]byte, binary.BigEndian.Uint16(size[:]))
+				if _, err := io.ReadFull(conn, query); err != nil {
+					return
+				}
+				answer := s.answer(query, false)
+				_, _ = conn.Write(append(binary.BigEndian.AppendUint16(nil, uint16(len(answer))), answer...))
+			}()
+		}
+	}()
+	return pc.LocalAddr().String()
+}
+
+func (s *stub) answer(packet []byte, truncate bool) []byte {
+	var query dnsmessage.Message
+	if err := query.Unpack(packet); err != nil || len(query.Questions) != 1 {
+		return nil
+	}
+	q := query.Questions[0]
+	msg := dnsmessage.Message{
+		Header: dnsmessage.Header{
+			ID:                 query.ID,
+			Response:           true,
+			RecursionAvailable: true,
+			RCode:              s.rcode,
+		},
+		Questions: query.Questions,
+	}
+	if s.badID {
+		msg.ID++
+	}
+	if truncate {
+		msg.Truncated = true
+		return pack(msg)
+	}
+
+	name := strings.TrimSuffix(q.Name.String(), ".")
+	if _, ok := s.zone[name]; !ok && s.rcode == dnsmessage.RCodeSuccess {
+		msg.RCode = dnsmessage.RCodeNameError
+	}
+	for hops := 0; hops < 10; hops++ {
+		rec, ok := s.zone[name]
+		if !ok {
+			break
+		}
+		hdr := dnsmessage.ResourceHeader{Name: dnsmessage.MustNewName(name + "."), Class: dnsmessage.ClassINET, TTL: 60}
+		if rec.cname != "" {
+			hdr.Type = dnsmessage.TypeCNAME
+			msg.Answers = append(msg.Answers, dnsmessage.Resource{
+				Header: hdr,
+				Body:   &dnsmessage.CNAMEResource{CNAME: dnsmessage.MustNewName(rec.cname + ".")},
+			})
+			if !s.follow {
+				break
+			}
+			name = rec.cname
+			continue
+		}
+		for _, a := range rec.addrs {
+			addr := netip.MustParseAddr(a)
+			switch {
+			case addr.Is4() && q.Type == dnsmessage.TypeA:
+				hdr.Type = dnsmessage.TypeA
+				msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AResource{A: addr.As4()}})
+			case addr.Is6() && q.Type == dnsmessage.TypeAAAA:
+				hdr.Type = dnsmessage.TypeAAAA
+				msg.Answers = append(msg.Answers, dnsmessage.Resource{Header: hdr, Body: &dnsmessage.AAAAResource{AAAA: addr.As16()}})
+			}
+		}
+		break
+	}
+	return pack(msg)
+}
+
+func pack(msg dnsmessage.Message) []byte {
+	packet, err := msg.Pack()
+	if err != nil {
+		panic(err)
+	}
+	return packet
+}
+
+var chainZone = map[string]record{
+	"www.example.com":   {cname: "cdn.example.net"},
+	"cdn.example.net":   {cname: "edge.example.org"},
+	"edge.example.org":  {addrs: []string{"192.0.2.1", "192.0.2.2", "2001:db8::1"}},
+	"plain.example.com": {addrs: []string{"192.0.2.3"}},
+	"loop-a.example":    {cname: "loop-b.example"},
+	"loop-b.example":    {cname: "loop-a.example"},
+	"dangling.example":  {cname: "missing.example"},
+}
+
+var wantChain = []Step{
+	{Name: "www.example.com", CNAME: "cdn.example.net"},
+	{Name: "cdn.example.net", CNAME: "edge.example.org"},
+	{Name: "edge.example.org", Addrs: []netip.Addr{
+		netip.MustParseAddr("192.0.2.1"),
+		netip.MustParseAddr("192.0.2.2"),
+		netip.MustParseAddr("2001:db8::1"),
+	}},
+}
+
+func TestResolve(t *testing.T) {
+	tests := []struct {
+		name    string
+		stub    stub
+		query   string
+		want    []Step
+		wantErr string
+		is      error
+	}{
+		{name: "chain in one answer", stub: stub{follow: true}, query: "WWW.Example.com.", want: wantChain},
+		{name: "chain across queries", query: "www.example.com", want: wantChain},
+		{name: "truncated", stub: stub{follow: true, truncate: true}, query: "www.example.com", want: wantChain},
+		{
+			name:  "no cname",
+			query: "plain.example.com",
+			want:  []Step{{Name: "plain.example.com", Addrs: []netip.Addr{netip.MustParseAddr("192.0.2.3")}}},
+		},
+		{name: "loop in one answer", stub: stub{follow: true}, query: "loop-a.example", wantErr: "CNAME loop"},
+		{name: "loop across queries", query: "loop-a.example", wantErr: "CNAME loop"},
+		{name: "nxdomain", query: "nope.example", is: ErrNotFound},
+		{name: "nxdomain in chain", query: "dangling.example", is: ErrNotFound},
+		{name: "servfail", stub: stub{rcode: dnsmessage.RCodeServerFailure}, query: "www.example.com", wantErr: "ServerFailure"},
+		{name: "id mismatch", stub: stub{badID: true}, query: "www.example.com", wantErr: "does not match"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := tt.stub
+			s.zone = chainZone
+			r := Resolver{Server: startStub(t, &s), Timeout: 2 * time.Second}
+
+			got, err := r.Resolve(context.Background(), tt.query)
+			switch {
+			case tt.is != nil:
+				if !errors.Is(err, tt.is) {
+					t.Fatalf("err = %v, want %v", err, tt.is)
+				}
+			case tt.wantErr != "":
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("err = %v, want %q", err, tt.wantErr)
+				}
+			case err != nil:
+				t.Fatal(err)
+			case !reflect.DeepEqual(got, tt.want):
+				t.Errorf("chain = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAddress(t *testing.T) {
+	tests := []struct{ server, want string }{
+		{"192.0.2.53", "192.0.2.53:53"},
+		{"192.0.2.53:5353", "192.0.2.53:5353"},
+		{"2001:db8::53", "[2001:db8::53]:53"},
+		{"[2001:db8::53]", "[2001:db8::53]:53"},
+		{"[2001:db8::53]:5353", "[2001:db8::53]:5353"},
+		{"dns.example", "dns.example:53"},
+	}
+	for _, tt := range tests {
+		r := Resolver{Server: tt.server}
+		if got := r.Address(); got != tt.want {
+			t.Errorf("Address(%q) = %q, want %q", tt.server, got, tt.want)
+		}
+	}
+}
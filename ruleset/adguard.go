@@ -0,0 +1,228 @@
+package ruleset
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"strings"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+)
+
+func init() {
+	for _, name := range []string{"adguard", "ublock"} {
+		register(Format{
+			Name:        name,
+			Description: "AdGuard/uBlock filter list (||example.com^)",
+			Parse:       ParseAdGuard,
+			Write:       WriteAdGuard,
+		})
+	}
+}
+
+// cosmeticMarkers separate the domains from the selector of element hiding
+// and scriptlet rules, which have no DNS meaning.
+var cosmeticMarkers = []string{"##", "#@#", "#?#", "#$#", "#%#"}
+
+// ParseAdGuard reads a filter list in AdGuard DNS / uBlock syntax:
+//
+//	||example.com^      the domain and its subdomains (namespace)
+//	|example.com^       exactly the domain
+//	||ads*.example.com^ wildcard
+//	/^ads?\./           regular expression
+//	example.com         plain entry, see ParseEntry
+//	0.0.0.0 example.com hosts-style line
+//
+// Exceptions (@@) have no MagiTrickle equivalent and are imported as
+// disabled rules. Modifiers ($...) are ignored and reported.
+func ParseAdGuard(r io.Reader, opts Options) (*Result, error) {
+	res := &Result{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "!") || strings.HasPrefix(text, "[") {
+			continue
+		}
+		if isCosmetic(text) {
+			res.issue(line, text, "cosmetic rules are not supported")
+			continue
+		}
+		if strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		if fields := strings.Fields(text); len(fields) > 1 {
+			if _, err := netip.ParseAddr(fields[0]); err == nil {
+				if err := parseHostsLine(res, line, text); err != nil {
+					res.issue(line, text, err.Error())
+				}
+				continue
+			}
+		}
+
+		body, exception := strings.CutPrefix(text, "@@")
+		body, modifiers := splitModifiers(body)
+		if strings.Contains(modifiers, "badfilter") {
+			res.issue(line, text, "$badfilter rules are not supported")
+			continue
+		}
+
+		rule, err := parseFilter(body, opts)
+		if err != nil {
+			res.issue(line, text, err.Error())
+			continue
+		}
+		if strings.HasPrefix(body, "||") && rule.Type == TypeWildcard {
+			res.issue(line, text, "imported as a wildcard rule, which does not match the subdomains")
+		}
+		if modifiers != "" {
+			res.issue(line, text, "modifiers $"+modifiers+" ignored")
+		}
+		if exception {
+			rule.Enable = false
+			res.issue(line, text, "exception imported as a disabled rule")
+		}
+		res.add(rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read filter list: %w", err)
+	}
+	return res, nil
+}
+
+func isCosmetic(text string) bool {
+	for _, marker := range cosmeticMarkers {
+		if strings.Contains(text, marker) {
+			return true
+		}
+	}
+	return false
+}
+
+// splitModifiers separates the $modifiers of a rule. For regex rules only
+// a $ after the closing slash starts the modifiers.
+func splitModifiers(text string) (body, modifiers string) {
+	if strings.HasPrefix(text, "/") {
+		if i := strings.LastIndex(text, "/$"); i > 0 {
+			return text[:i+1], text[i+2:]
+		}
+		return text, ""
+	}
+	if i := strings.LastIndexByte(text, '$'); i >= 0 {
+		return text[:i], text[i+1:]
+	}
+	return text, ""
+}
+
+func parseFilter(body string, opts Options) (types.RuleReq, error) {
+	if len(body) > 2 && strings.HasPrefix(body, "/") && strings.HasSuffix(body, "/") {
+		return regexRule(strings.ReplaceAll(body[1:len(body)-1], `\/`, "/"))
+	}
+
+	ruleType := ""
+	switch {
+	case strings.HasPrefix(body, "||"):
+		body, ruleType = body[2:], TypeNamespace
+	case strings.HasPrefix(body, "|"):
+		body, ruleType = body[1:], TypeDomain
+	}
+	body = strings.TrimSuffix(strings.TrimSuffix(body, "|"), "^")
+	if body == "" {
+		return types.RuleReq{}, errors.New("empty rule")
+	}
+	if strings.ContainsAny(body, "/:^|") {
+		return types.RuleReq{}, errors.New("URL rules are not supported")
+	}
+
+	switch {
+	case ruleType == "":
+		return ParseEntry(body, opts)
+	case strings.ContainsAny(body, "*?"):
+		pattern, err := normalizeWildcard(body)
+		if err != nil {
+			return types.RuleReq{}, err
+		}
+		return types.RuleReq{Type: TypeWildcard, Rule: pattern, Enable: true}, nil
+	}
+	return domainRule(body, ruleType)
+}
+
+// WriteAdGuard writes rules in AdGuard/uBlock syntax. Disabled rules are
+// written as comments; subnets cannot be expressed.
+func WriteAdGuard(w io.Writer, rules []types.RuleRes) ([]Issue, error) {
+	var issues []Issue
+	bw := bufio.NewWriter(w)
+	for _, r := range rules {
+		var filter string
+		switch r.Type {
+		case TypeDomain:
+			filter = "|" + r.Rule + "^"
+		case TypeNamespace:
+			filter = "||" + r.Rule + "^"
+		case TypeWildcard:
+			if strings.Contains(r.Rule, "?") {
+				filter = "/" + wildcardToRegex(r.Rule) + "/"
+			} else {
+				filter = "|" + r.Rule + "^"
+				if strings.Contains(r.Rule, ".") {
+					issues = append(issues, ruleIssue(r, literalDotIssue))
+				}
+			}
+		case TypeRegex:
+			filter = "/" + escapeSlashes(r.Rule) + "/"
+		default:
+			issues = append(issues, ruleIssue(r, "not supported in filter lists"))
+			continue
+		}
+		if !r.Enable {
+			filter = "! " + filter
+		}
+		fmt.Fprintln(bw, filter)
+	}
+	return issues, bw.Flush()
+}
+
+// literalDotIssue describes a wildcard written in a syntax where . is a literal
+// dot, while the daemon lets it match any character.
+const literalDotIssue = "written with . as a literal dot, the daemon matches any character"
+
+// wildcardToRegex converts a wildcard rule into an anchored regex with the
+// daemon's semantics: * matches any sequence, ? one character or none and
+// . exactly one character.
+func wildcardToRegex(pattern string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, c := range pattern {
+		switch c {
+		case '*':
+			b.WriteString(".*")
+		case '?':
+			b.WriteString(".?")
+		case '.':
+			b.WriteString(".")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// escapeSlashes escapes the slashes that would end a /regex/ rule.
+func escapeSlashes(expr string) string {
+	var b strings.Builder
+	escaped := false
+	for _, c := range expr {
+		if c == '/' && !escaped {
+			b.WriteByte('\\')
+		}
+		escaped = c == '\\' && !escaped
+		b.WriteRune(c)
+	}
+	return b.String()
+}
@@ -0,0 +1,242 @@
+package ruleset
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+	"gopkg.in/yaml.v3"
+)
+
+func init() {
+	register(Format{
+		Name:        "clash",
+		Description: "Clash/mihomo rule provider (payload YAML or classical text)",
+		Parse:       ParseClash,
+		Write:       WriteClash,
+	})
+}
+
+// ParseClash reads a Clash rule provider, either YAML with a payload list
+// or a text file with one entry per line. Classical entries are supported:
+//
+//	DOMAIN,example.com          domain
+//	DOMAIN-SUFFIX,example.com   namespace
+//	DOMAIN-KEYWORD,google       wildcard *google*
+//	DOMAIN-REGEX,^ads?\.        regex (mihomo)
+//	DOMAIN-WILDCARD,*.example.* wildcard (mihomo)
+//	IP-CIDR,192.0.2.0/24        subnet
+//	IP-CIDR6,2001:db8::/32      subnet6
+//
+// as well as the entries of domain and ipcidr providers (+.example.com,
+// .example.com, *.example.com, example.com, CIDRs).
+func ParseClash(r io.Reader, _ Options) (*Result, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	res := &Result{}
+	var provider struct {
+		Payload []string `yaml:"payload"`
+	}
+	if err := yaml.Unmarshal(content, &provider); err == nil && provider.Payload != nil {
+		for _, entry := range provider.Payload {
+			parseClashEntry(res, 0, entry)
+		}
+		return res, nil
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(content))
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") || text == "payload:" {
+			continue
+		}
+		// Lines of a YAML payload that failed to parse as a whole.
+		text = strings.Trim(strings.TrimSpace(strings.TrimPrefix(text, "- ")), `'"`)
+		parseClashEntry(res, line, text)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read rule provider: %w", err)
+	}
+	return res, nil
+}
+
+func parseClashEntry(res *Result, line int, entry string) {
+	entry = strings.TrimSpace(entry)
+	rule, lossy, err := clashRule(entry)
+	if err != nil {
+		res.issue(line, entry, err.Error())
+		return
+	}
+	if lossy != "" {
+		res.issue(line, entry, lossy)
+	}
+	res.add(rule)
+}
+
+// clashRule converts one payload entry. lossy describes a difference in
+// matching between Clash and MagiTrickle.
+func clashRule(entry string) (rule types.RuleReq, lossy string, err error) {
+	kind, value, classical := strings.Cut(entry, ",")
+	if !classical {
+		return clashDomainEntry(entry)
+	}
+
+	kind = strings.ToUpper(strings.TrimSpace(kind))
+	if kind == "DOMAIN-REGEX" {
+		// A regex may contain commas itself, e.g. a{1,3}.
+		if value, err = clashRegexValue(value); err != nil {
+			return rule, "", err
+		}
+	} else {
+		// Further fields are the policy or options such as no-resolve.
+		value, _, _ = strings.Cut(value, ",")
+	}
+	value = strings.TrimSpace(value)
+	switch kind {
+	case "DOMAIN":
+		rule, err = domainRule(value, TypeDomain)
+	case "DOMAIN-SUFFIX":
+		rule, err = domainRule(value, TypeNamespace)
+	case "DOMAIN-KEYWORD":
+		rule, err = ParseEntry("keyword:"+value, Options{})
+	case "DOMAIN-REGEX":
+		rule, err = regexRule(value)
+	case "DOMAIN-WILDCARD":
+		rule, err = wildcardRule(value)
+	case "IP-CIDR", "IP-CIDR6":
+		var ok bool
+		if rule, ok = parseSubnet(value); !ok {
+			err = errors.New("invalid CIDR")
+		}
+	default:
+		err = fmt.Errorf("rule type %s is not supported", kind)
+	}
+	return rule, "", err
+}
+
+// clashPolicies and clashOptions are the trailing fields stripped from a
+// DOMAIN-REGEX entry. Other policy names cannot be told from the regex.
+var (
+	clashPolicies = []string{"DIRECT", "REJECT", "REJECT-DROP", "PASS", "PROXY"}
+	clashOptions  = []string{"no-resolve", "src"}
+)
+
+// clashRegexValue strips known trailing fields from the value of a
+// DOMAIN-REGEX entry. A remaining comma is kept as part of the regex when
+// the text after it contains regex syntax; otherwise it may separate an
+// unknown policy and the entry is refused.
+func clashRegexValue(value string) (string, error) {
+	stripField := func(fields []string) bool {
+		i := strings.LastIndexByte(value, ',')
+		if i < 0 {
+			return false
+		}
+		for _, f := range fields {
+			if strings.EqualFold(strings.TrimSpace(value[i+1:]), f) {
+				value = value[:i]
+				return true
+			}
+		}
+		return false
+	}
+	for stripField(clashOptions) {
+		// no-resolve and src may both be given.
+	}
+	stripField(clashPolicies)
+
+	if i := strings.LastIndexByte(value, ','); i >= 0 {
+		tail := strings.TrimSpace(value[i+1:])
+		if !strings.ContainsAny(tail, `\^$.|?*+()[]{}`) {
+			return "", fmt.Errorf("cannot tell the regex from the policy %q", tail)
+		}
+	}
+	return value, nil
+}
+
+// clashDomainEntry converts an entry of a domain or ipcidr provider.
+// There * matches a single label, while MagiTrickle wildcards match any
+// number of labels.
+func clashDomainEntry(entry string) (types.RuleReq, string, error) {
+	if rule, ok := parseSubnet(entry); ok {
+		return rule, "", nil
+	}
+	switch {
+	case strings.HasPrefix(entry, "+."):
+		rule, err := domainRule(entry[2:], TypeNamespace)
+		return rule, "", err
+	case strings.HasPrefix(entry, "."):
+		rule, err := wildcardRule("*" + entry)
+		return rule, "", err
+	case strings.ContainsAny(entry, "*"):
+		rule, err := wildcardRule(entry)
+		return rule, "* now also matches several labels", err
+	}
+	rule, err := domainRule(entry, TypeDomain)
+	return rule, "", err
+}
+
+func wildcardRule(pattern string) (types.RuleReq, error) {
+	pattern, err := normalizeWildcard(pattern)
+	if err != nil {
+		return types.RuleReq{}, err
+	}
+	return types.RuleReq{Type: TypeWildcard, Rule: pattern, Enable: true}, nil
+}
+
+// WriteClash writes a classical rule provider. Regexes and wildcards need
+// DOMAIN-REGEX, which only mihomo (Clash.Meta) supports. Disabled rules are
+// written as comments.
+func WriteClash(w io.Writer, rules []types.RuleRes) ([]Issue, error) {
+	var issues []Issue
+	bw := bufio.NewWriter(w)
+	fmt.Fprintln(bw, "payload:")
+	for _, r := range rules {
+		var entry string
+		switch r.Type {
+		case TypeDomain:
+			entry = "DOMAIN," + r.Rule
+		case TypeNamespace:
+			entry = "DOMAIN-SUFFIX," + r.Rule
+		case TypeWildcard:
+			if keyword, ok := wildcardKeyword(r.Rule); ok {
+				entry = "DOMAIN-KEYWORD," + keyword
+				if strings.Contains(keyword, ".") {
+					issues = append(issues, ruleIssue(r, literalDotIssue))
+				}
+			} else {
+				entry = "DOMAIN-REGEX," + wildcardToRegex(r.Rule)
+				issues = append(issues, ruleIssue(r, "written as DOMAIN-REGEX, which requires mihomo"))
+			}
+		case TypeRegex:
+			if strings.Contains(r.Rule, ",") {
+				issues = append(issues, ruleIssue(r, "regexes with commas cannot be written"))
+				continue
+			}
+			entry = "DOMAIN-REGEX," + r.Rule
+			issues = append(issues, ruleIssue(r, "DOMAIN-REGEX requires mihomo"))
+		case TypeSubnet:
+			entry = "IP-CIDR," + r.Rule + ",no-resolve"
+		case TypeSubnet6:
+			entry = "IP-CIDR6," + r.Rule + ",no-resolve"
+		default:
+			issues = append(issues, ruleIssue(r, "unknown rule type"))
+			continue
+		}
+
+		prefix := "  "
+		if !r.Enable {
+			prefix = "  # "
+		}
+		fmt.Fprintf(bw, "%s- '%s'\n", prefix, strings.ReplaceAll(entry, "'", "''"))
+	}
+	return issues, bw.Flush()
+}
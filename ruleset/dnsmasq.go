@@ -0,0 +1,124 @@
+package ruleset
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+)
+
+// Set is a named list of rules, such as an ipset of a dnsmasq config.
+type Set struct {
+	Name  string
+	Rules []types.RuleReq
+}
+
+// SetsResult is the outcome of parsing a file that defines several sets.
+type SetsResult struct {
+	Sets   []Set
+	Issues []Issue
+}
+
+// ParseDnsmasq reads ipset= and nftset= lines of a dnsmasq config:
+//
+//	ipset=/example.com/example.org/vpn,search
+//	nftset=/example.com/4#inet#fw#vpn4,6#inet#fw#vpn6
+//
+// Every domain is added to every set named on its line. dnsmasq matches
+// subdomains too, so domains become opts.DomainType rules (namespace by
+// default). All other directives are reported as issues.
+func ParseDnsmasq(r io.Reader, opts Options) (*SetsResult, error) {
+	res := &SetsResult{}
+	sets := make(map[string]*Result)
+	var order []string
+
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+
+		key, value, _ := strings.Cut(text, "=")
+		key = strings.TrimSpace(key)
+		if key != "ipset" && key != "nftset" {
+			res.issue(line, text, "not an ipset or nftset directive")
+			continue
+		}
+
+		value = strings.TrimSpace(value)
+		end := strings.LastIndex(value, "/")
+		if !strings.HasPrefix(value, "/") || end == 0 {
+			res.issue(line, text, "expected /domain/.../set")
+			continue
+		}
+
+		names := parseSetNames(key, value[end+1:])
+		if len(names) == 0 {
+			res.issue(line, text, "no set name")
+			continue
+		}
+
+		var rules []types.RuleReq
+		for _, domain := range strings.Split(value[1:end], "/") {
+			switch domain {
+			case "":
+				res.issue(line, text, "empty domain (unqualified names) is not supported")
+				continue
+			case "#":
+				res.issue(line, text, "# (all domains) is not supported")
+				continue
+			}
+			rule, err := ParseEntry(domain, opts)
+			if err != nil {
+				res.issue(line, domain, err.Error())
+				continue
+			}
+			rules = append(rules, rule)
+		}
+
+		for _, name := range names {
+			set, ok := sets[name]
+			if !ok {
+				set = &Result{}
+				sets[name] = set
+				order = append(order, name)
+			}
+			for _, rule := range rules {
+				set.add(rule)
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read dnsmasq config: %w", err)
+	}
+
+	for _, name := range order {
+		res.Sets = append(res.Sets, Set{Name: name, Rules: sets[name].Rules})
+	}
+	return res, nil
+}
+
+// parseSetNames splits the comma-separated set list. nftset entries look
+// like [4#|6#]family#table#set; only the set name is kept.
+func parseSetNames(key, list string) []string {
+	var names []string
+	for _, spec := range strings.Split(list, ",") {
+		spec = strings.TrimSpace(spec)
+		if key == "nftset" {
+			spec = spec[strings.LastIndex(spec, "#")+1:]
+		}
+		if spec != "" {
+			names = append(names, spec)
+		}
+	}
+	return names
+}
+
+func (r *SetsResult) issue(line int, text, reason string) {
+	r.Issues = append(r.Issues, Issue{Line: line, Text: text, Reason: reason})
+}
@@ -0,0 +1,255 @@
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+)
+
+func init() {
+	register(Format{
+		Name:        "geosite",
+		Description: "v2ray/xray geosite.dat, needs categories",
+		Parse:       ParseGeoSite,
+	})
+	register(Format{
+		Name:        "geoip",
+		Description: "v2ray/xray geoip.dat, needs categories",
+		Parse:       ParseGeoIP,
+	})
+}
+
+// Domain types of the geosite Domain message.
+const (
+	geoDomainPlain  = 0
+	geoDomainRegex  = 1
+	geoDomainDomain = 2
+	geoDomainFull   = 3
+)
+
+// geoCategory selects a category of a geo file, optionally filtered by
+// attributes: "youtube", "google@ads" or "cn@!ads".
+type geoCategory struct {
+	code  string
+	with  []string
+	not   []string
+	found bool
+}
+
+func parseGeoCategories(specs []string) ([]*geoCategory, error) {
+	if len(specs) == 0 {
+		return nil, errors.New("no category selected")
+	}
+	var categories []*geoCategory
+	for _, spec := range specs {
+		parts := strings.Split(strings.TrimSpace(spec), "@")
+		if parts[0] == "" {
+			return nil, fmt.Errorf("invalid category %q", spec)
+		}
+		c := &geoCategory{code: strings.ToUpper(parts[0])}
+		for _, attr := range parts[1:] {
+			attr = strings.ToLower(attr)
+			if negated, ok := strings.CutPrefix(attr, "!"); ok {
+				c.not = append(c.not, negated)
+			} else if attr != "" {
+				c.with = append(c.with, attr)
+			}
+		}
+		categories = append(categories, c)
+	}
+	return categories, nil
+}
+
+func (c *geoCategory) matchAttrs(attrs map[string]bool) bool {
+	for _, attr := range c.with {
+		if !attrs[attr] {
+			return false
+		}
+	}
+	for _, attr := range c.not {
+		if attrs[attr] {
+			return false
+		}
+	}
+	return true
+}
+
+// selectGeoEntries walks the entries of a GeoSiteList or GeoIPList (both
+// have the country code as field 1) and calls fn for every entry matched
+// by a category. It fails on categories that are not in the file.
+func selectGeoEntries(r io.Reader, specs []string, fn func(c *geoCategory, entry []byte) error) error {
+	categories, err := parseGeoCategories(specs)
+	if err != nil {
+		return err
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+
+	err = walkProto(content, func(num int, _ uint64, entry []byte) error {
+		if num != 1 {
+			return nil
+		}
+		var code string
+		if err := walkProto(entry, func(num int, _ uint64, data []byte) error {
+			if num == 1 {
+				code = strings.ToUpper(string(data))
+			}
+			return nil
+		}); err != nil {
+			return err
+		}
+		for _, c := range categories {
+			if c.code != code {
+				continue
+			}
+			c.found = true
+			if err := fn(c, entry); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("invalid geo file: %w", err)
+	}
+
+	for _, c := range categories {
+		if !c.found {
+			return fmt.Errorf("category %q not found", strings.ToLower(c.code))
+		}
+	}
+	return nil
+}
+
+// ParseGeoSite reads the categories in opts.Categories from a geosite.dat
+// file. Domain types map to rule types:
+//
+//	Plain (keyword)  wildcard *keyword*
+//	Regex            regex
+//	Domain           namespace
+//	Full             domain
+func ParseGeoSite(r io.Reader, opts Options) (*Result, error) {
+	res := &Result{}
+	err := selectGeoEntries(r, opts.Categories, func(c *geoCategory, site []byte) error {
+		return walkProto(site, func(num int, _ uint64, data []byte) error {
+			if num != 2 {
+				return nil
+			}
+			domainType, value, attrs, err := decodeGeoDomain(data)
+			if err != nil {
+				return err
+			}
+			if !c.matchAttrs(attrs) {
+				return nil
+			}
+
+			var rule types.RuleReq
+			switch domainType {
+			case geoDomainPlain:
+				rule, err = ParseEntry("keyword:"+value, Options{})
+			case geoDomainRegex:
+				rule, err = regexRule(value)
+			case geoDomainDomain:
+				rule, err = domainRule(value, TypeNamespace)
+			case geoDomainFull:
+				rule, err = domainRule(value, TypeDomain)
+			default:
+				err = fmt.Errorf("unknown domain type %d", domainType)
+			}
+			if err != nil {
+				res.issue(0, value, err.Error())
+				return nil
+			}
+			res.add(rule)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// decodeGeoDomain decodes a Domain message: type = 1, value = 2 and
+// repeated attribute = 3 (key = 1).
+func decodeGeoDomain(b []byte) (domainType uint64, value string, attrs map[string]bool, err error) {
+	attrs = make(map[string]bool)
+	err = walkProto(b, func(num int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			domainType = v
+		case 2:
+			value = string(data)
+		case 3:
+			return walkProto(data, func(num int, _ uint64, data []byte) error {
+				if num == 1 {
+					attrs[strings.ToLower(string(data))] = true
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return domainType, value, attrs, err
+}
+
+// ParseGeoIP reads the CIDRs of the categories in opts.Categories from a
+// geoip.dat file.
+func ParseGeoIP(r io.Reader, opts Options) (*Result, error) {
+	res := &Result{}
+	err := selectGeoEntries(r, opts.Categories, func(c *geoCategory, geoIP []byte) error {
+		if len(c.with) > 0 || len(c.not) > 0 {
+			return errors.New("geoip categories have no attributes")
+		}
+		return walkProto(geoIP, func(num int, v uint64, data []byte) error {
+			switch num {
+			case 2:
+				prefix, err := decodeGeoCIDR(data)
+				if err != nil {
+					res.issue(0, strings.ToLower(c.code), err.Error())
+					return nil
+				}
+				rule, _ := parseSubnet(prefix.String())
+				res.add(rule)
+			case 3:
+				if v != 0 {
+					res.issue(0, strings.ToLower(c.code), "reverse match is not supported, the CIDRs are imported as is")
+				}
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// decodeGeoCIDR decodes a CIDR message: ip = 1 (4 or 16 bytes), prefix = 2.
+func decodeGeoCIDR(b []byte) (netip.Prefix, error) {
+	var ip []byte
+	var bits uint64
+	if err := walkProto(b, func(num int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			ip = data
+		case 2:
+			bits = v
+		}
+		return nil
+	}); err != nil {
+		return netip.Prefix{}, err
+	}
+
+	addr, ok := netip.AddrFromSlice(ip)
+	if !ok || bits > uint64(addr.BitLen()) {
+		return netip.Prefix{}, fmt.Errorf("invalid CIDR %x/%d", ip, bits)
+	}
+	return netip.PrefixFrom(addr, int(bits)).Masked(), nil
+}
@@ -0,0 +1,168 @@
+package ruleset
+
+import (
+	"bytes"
+	"encoding/binary"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Hand-encoded protobuf fields for the test files.
+func pbVarint(num int, v uint64) []byte {
+	return binary.AppendUvarint(binary.AppendUvarint(nil, uint64(num)<<3|wireVarint), v)
+}
+
+func pbBytes(num int, fields ...[]byte) []byte {
+	data := bytes.Join(fields, nil)
+	b := binary.AppendUvarint(nil, uint64(num)<<3|wireBytes)
+	return append(binary.AppendUvarint(b, uint64(len(data))), data...)
+}
+
+func pbString(num int, s string) []byte {
+	return pbBytes(num, []byte(s))
+}
+
+func geoDomain(domainType uint64, value string, attrs ...string) []byte {
+	fields := [][]byte{pbVarint(1, domainType), pbString(2, value)}
+	for _, attr := range attrs {
+		fields = append(fields, pbBytes(3, pbString(1, attr), pbVarint(2, 1)))
+	}
+	return pbBytes(2, fields...)
+}
+
+func geoCIDR(ip []byte, bits uint64) []byte {
+	return pbBytes(2, pbBytes(1, ip), pbVarint(2, bits))
+}
+
+var testGeoSite = bytes.Join([][]byte{
+	pbBytes(1,
+		pbString(1, "google"),
+		geoDomain(geoDomainPlain, "google"),
+		geoDomain(geoDomainRegex, `^ads\.`),
+		geoDomain(geoDomainDomain, "google.com"),
+		geoDomain(geoDomainFull, "www.google.com"),
+		geoDomain(geoDomainDomain, "doubleclick.net", "ads"),
+		geoDomain(7, "unknown.example"),
+	),
+	pbBytes(1,
+		pbString(1, "CN"),
+		// Fixed-size fields are skipped.
+		binary.LittleEndian.AppendUint32(binary.AppendUvarint(nil, 9<<3|wireFixed32), 1),
+		geoDomain(geoDomainDomain, "baidu.com", "CN"),
+	),
+}, nil)
+
+func TestParseGeoSite(t *testing.T) {
+	tests := []struct {
+		categories []string
+		want       []string
+		issues     int
+		wantErr    string
+	}{
+		{
+			categories: []string{"google"},
+			want: []string{
+				"wildcard *google*",
+				`regex ^ads\.`,
+				"namespace google.com",
+				"domain www.google.com",
+				"namespace doubleclick.net",
+			},
+			issues: 1,
+		},
+		{categories: []string{"GOOGLE@ads"}, want: []string{"namespace doubleclick.net"}},
+		{categories: []string{"google@!ads@!nothing"}, want: []string{"wildcard *google*", `regex ^ads\.`, "namespace google.com", "domain www.google.com"}, issues: 1},
+		{categories: []string{"cn@cn", "google@ads"}, want: []string{"namespace doubleclick.net", "namespace baidu.com"}},
+		{categories: []string{"cn@ads"}},
+		{categories: []string{"youtube"}, wantErr: `category "youtube" not found`},
+		{categories: []string{"@ads"}, wantErr: "invalid category"},
+		{wantErr: "no category selected"},
+	}
+	for _, tt := range tests {
+		res, err := ParseGeoSite(bytes.NewReader(testGeoSite), Options{Categories: tt.categories})
+		if tt.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("%q: err = %v, want %q", tt.categories, err, tt.wantErr)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%q: %v", tt.categories, err)
+			continue
+		}
+		var got []string
+		for _, r := range res.Rules {
+			got = append(got, r.Type+" "+r.Rule)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%q: rules = %q, want %q", tt.categories, got, tt.want)
+		}
+		if len(res.Issues) != tt.issues {
+			t.Errorf("%q: issues = %v, want %d", tt.categories, res.Issues, tt.issues)
+		}
+	}
+}
+
+func TestParseGeoIP(t *testing.T) {
+	file := bytes.Join([][]byte{
+		pbBytes(1,
+			pbString(1, "private"),
+			geoCIDR([]byte{10, 1, 2, 3}, 8),
+			geoCIDR([]byte{192, 0, 2, 1}, 32),
+			geoCIDR(append([]byte{0xfc}, make([]byte, 15)...), 7),
+			geoCIDR([]byte{192, 0, 2, 0}, 33),
+			geoCIDR([]byte{192, 0, 2}, 24),
+		),
+		pbBytes(1, pbString(1, "cn"), geoCIDR([]byte{198, 51, 100, 0}, 24), pbVarint(3, 1)),
+	}, nil)
+
+	res, err := ParseGeoIP(bytes.NewReader(file), Options{Categories: []string{"private", "cn"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, r := range res.Rules {
+		got = append(got, r.Type+" "+r.Rule)
+	}
+	want := []string{
+		"subnet 10.0.0.0/8",
+		"subnet 192.0.2.1/32",
+		"subnet6 fc00::/7",
+		"subnet 198.51.100.0/24",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rules = %q, want %q", got, want)
+	}
+	// Two invalid CIDRs and the reverse match.
+	if len(res.Issues) != 3 || !strings.Contains(res.Issues[2].Reason, "reverse match") {
+		t.Errorf("issues = %v", res.Issues)
+	}
+
+	if _, err := ParseGeoIP(bytes.NewReader(file), Options{Categories: []string{"cn@ads"}}); err == nil {
+		t.Error("geoip category with attributes accepted")
+	}
+}
+
+func TestParseGeoTruncated(t *testing.T) {
+	// The last category is incomplete in every prefix of the file.
+	for i := 0; i < len(testGeoSite); i++ {
+		if _, err := ParseGeoSite(bytes.NewReader(testGeoSite[:i]), Options{Categories: []string{"cn"}}); err == nil {
+			t.Errorf("%d of %d bytes: no error", i, len(testGeoSite))
+		}
+	}
+
+	for _, b := range [][]byte{
+		{0x0a},                   // field key without length
+		{0x0a, 0x05, 'a'},        // length past the end
+		{0x08},                   // varint without value
+		{0x08, 0x80},             // unterminated varint
+		{0x0d, 0x01, 0x02},       // short fixed32
+		{0x0b},                   // group wire type
+		{0x0a, 0x02, 0x12, 0x05}, // truncated nested message
+	} {
+		if _, err := ParseGeoSite(bytes.NewReader(b), Options{Categories: []string{"a"}}); err == nil {
+			t.Errorf("% x: no error", b)
+		}
+	}
+}
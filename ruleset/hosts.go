@@ -0,0 +1,109 @@
+package ruleset
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"strings"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+)
+
+func init() {
+	register(Format{
+		Name:        "hosts",
+		Description: "/etc/hosts style, IP followed by host names",
+		Parse:       ParseHosts,
+		Write:       WriteHosts,
+	})
+}
+
+// localHostNames are found in most hosts files and never imported.
+var localHostNames = map[string]bool{
+	"localhost":             true,
+	"localhost.localdomain": true,
+	"local":                 true,
+	"broadcasthost":         true,
+	"ip6-localhost":         true,
+	"ip6-loopback":          true,
+	"ip6-localnet":          true,
+	"ip6-mcastprefix":       true,
+	"ip6-allnodes":          true,
+	"ip6-allrouters":        true,
+	"ip6-allhosts":          true,
+	"0.0.0.0":               true,
+}
+
+// ParseHosts reads a hosts file. The addresses are ignored; every host name
+// becomes an exact domain rule, as hosts files do not match subdomains.
+func ParseHosts(r io.Reader, _ Options) (*Result, error) {
+	res := &Result{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		if err := parseHostsLine(res, line, scanner.Text()); err != nil {
+			res.issue(line, strings.TrimSpace(scanner.Text()), err.Error())
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read hosts file: %w", err)
+	}
+	return res, nil
+}
+
+// parseHostsLine adds the host names of one line. Invalid names are
+// reported individually; an error rejects the whole line.
+func parseHostsLine(res *Result, line int, text string) error {
+	if i := strings.IndexByte(text, '#'); i >= 0 {
+		text = text[:i]
+	}
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return nil
+	}
+	if _, err := netip.ParseAddr(fields[0]); err != nil {
+		return errors.New("expected an IP address")
+	}
+	if len(fields) == 1 {
+		return errors.New("no host names")
+	}
+
+	for _, host := range fields[1:] {
+		if localHostNames[strings.ToLower(host)] {
+			continue
+		}
+		rule, err := domainRule(host, TypeDomain)
+		if err != nil {
+			res.issue(line, host, err.Error())
+			continue
+		}
+		res.add(rule)
+	}
+	return nil
+}
+
+// WriteHosts writes domain rules as "0.0.0.0 name" lines. Namespaces lose
+// their subdomains; other rule types cannot be expressed.
+func WriteHosts(w io.Writer, rules []types.RuleRes) ([]Issue, error) {
+	var issues []Issue
+	bw := bufio.NewWriter(w)
+	for _, r := range rules {
+		switch r.Type {
+		case TypeDomain:
+		case TypeNamespace:
+			issues = append(issues, ruleIssue(r, "written without its subdomains"))
+		default:
+			issues = append(issues, ruleIssue(r, "not supported in hosts files"))
+			continue
+		}
+		prefix := ""
+		if !r.Enable {
+			prefix = "# "
+		}
+		fmt.Fprintf(bw, "%s0.0.0.0 %s\n", prefix, r.Rule)
+	}
+	return issues, bw.Flush()
+}
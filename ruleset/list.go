@@ -0,0 +1,106 @@
+package ruleset
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+)
+
+func init() {
+	register(Format{
+		Name:        "list",
+		Description: "one entry per line, # comments",
+		Parse:       ParseList,
+		Write:       WriteList,
+	})
+}
+
+// ParseList reads one entry per line (see ParseEntry). Blank lines and
+// comments are skipped. A # starts a comment at the beginning of a line or
+// after whitespace, so entries such as /^a#b/ are kept whole.
+func ParseList(r io.Reader, opts Options) (*Result, error) {
+	res := &Result{}
+	scanner := bufio.NewScanner(r)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := stripComment(strings.TrimSpace(scanner.Text()))
+		if text == "" {
+			continue
+		}
+		if strings.ContainsAny(text, " \t") {
+			res.issue(line, text, "expected a single entry per line")
+			continue
+		}
+
+		rule, err := ParseEntry(text, opts)
+		if err != nil {
+			res.issue(line, text, err.Error())
+			continue
+		}
+		res.add(rule)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read list: %w", err)
+	}
+	return res, nil
+}
+
+// stripComment cuts a trailing comment from a trimmed line. The body of a
+// /.../ regex, which ends at a slash followed by whitespace, is never cut.
+func stripComment(text string) string {
+	start := 0
+	if strings.HasPrefix(text, "/") {
+		start = len(text)
+		for i := 1; i < len(text); i++ {
+			if text[i] == '/' && (i == len(text)-1 || text[i+1] == ' ' || text[i+1] == '\t') {
+				start = i + 1
+				break
+			}
+		}
+	}
+	for i := start; i < len(text); i++ {
+		if text[i] == '#' && (i == 0 || text[i-1] == ' ' || text[i-1] == '\t') {
+			return strings.TrimSpace(text[:i])
+		}
+	}
+	return text
+}
+
+// WriteList writes one entry per line in the syntax read by ParseList.
+// Disabled rules are written as comments.
+func WriteList(w io.Writer, rules []types.RuleRes) ([]Issue, error) {
+	var issues []Issue
+	bw := bufio.NewWriter(w)
+	for _, r := range rules {
+		var entry string
+		switch r.Type {
+		case TypeNamespace, TypeSubnet, TypeSubnet6:
+			entry = r.Rule
+		case TypeDomain:
+			entry = "full:" + r.Rule
+		case TypeWildcard:
+			if !strings.ContainsAny(r.Rule, "*?") {
+				entry = "full:" + r.Rule
+				if strings.Contains(r.Rule, ".") {
+					issues = append(issues, ruleIssue(r, literalDotIssue))
+				}
+			} else {
+				entry = r.Rule
+			}
+		case TypeRegex:
+			entry = "regexp:" + r.Rule
+		default:
+			issues = append(issues, ruleIssue(r, "unknown rule type"))
+			continue
+		}
+		if !r.Enable {
+			entry = "# " + entry
+		}
+		fmt.Fprintln(bw, entry)
+	}
+	return issues, bw.Flush()
+}
@@ -0,0 +1,65 @@
+package ruleset
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+)
+
+// Protobuf wire types.
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+	wireFixed32 = 5
+)
+
+var errTruncated = errors.New("truncated protobuf message")
+
+// walkProto calls fn for every field of an encoded protobuf message. v is
+// set for varint fields, data for length-delimited ones; fixed-size fields
+// are skipped. The geo files only need this much of the format, so no
+// protobuf library is pulled in.
+func walkProto(b []byte, fn func(num int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+		num, wireType := int(key>>3), key&7
+
+		var v uint64
+		var data []byte
+		switch wireType {
+		case wireVarint:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+		case wireFixed64, wireFixed32:
+			size := 8
+			if wireType == wireFixed32 {
+				size = 4
+			}
+			if len(b) < size {
+				return errTruncated
+			}
+			b = b[size:]
+			continue
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return errTruncated
+			}
+			data, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			return fmt.Errorf("unsupported protobuf wire type %d", wireType)
+		}
+
+		if err := fn(num, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,283 @@
+// Package ruleset converts rules between MagiTrickle and the list formats
+// of other DNS and proxy tools.
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/netip"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+	"golang.org/x/net/idna"
+)
+
+// Rule types understood by MagiTrickle.
+const (
+	TypeDomain    = "domain"
+	TypeNamespace = "namespace"
+	TypeWildcard  = "wildcard"
+	TypeRegex     = "regex"
+	TypeSubnet    = "subnet"
+	TypeSubnet6   = "subnet6"
+)
+
+// Options control how entries are converted.
+type Options struct {
+	// DomainType is the rule type for plain domain names, TypeNamespace
+	// (the domain and its subdomains) or TypeDomain (exact match).
+	DomainType string
+	// Categories selects the categories of geosite and geoip files, e.g.
+	// "youtube", "google@ads" or "cn@!ads".
+	Categories []string
+}
+
+func (o Options) domainType() string {
+	if o.DomainType == "" {
+		return TypeNamespace
+	}
+	return o.DomainType
+}
+
+// Issue is an input entry that was skipped or not converted exactly.
+type Issue struct {
+	// Line is 1-based, or 0 when the format has no lines.
+	Line   int
+	Text   string
+	Reason string
+}
+
+func (i Issue) String() string {
+	if i.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", i.Line, i.Text, i.Reason)
+	}
+	return fmt.Sprintf("%s: %s", i.Text, i.Reason)
+}
+
+// Result is the outcome of parsing a rule list.
+type Result struct {
+	Rules  []types.RuleReq
+	Issues []Issue
+
+	seen map[string]bool
+}
+
+func (r *Result) add(rule types.RuleReq) {
+	if r.seen == nil {
+		r.seen = make(map[string]bool)
+	}
+	key := Key(rule.Type, rule.Rule)
+	if r.seen[key] {
+		return
+	}
+	r.seen[key] = true
+	r.Rules = append(r.Rules, rule)
+}
+
+func (r *Result) issue(line int, text, reason string) {
+	r.Issues = append(r.Issues, Issue{Line: line, Text: text, Reason: reason})
+}
+
+// ruleIssue reports a rule that could not be exported exactly.
+func ruleIssue(r types.RuleRes, reason string) Issue {
+	return Issue{Text: r.Type + " " + r.Rule, Reason: reason}
+}
+
+// Key identifies a rule by type and value, for de-duplication.
+func Key(ruleType, rule string) string {
+	return ruleType + "\x00" + rule
+}
+
+// Format is a supported foreign rule format.
+type Format struct {
+	Name        string
+	Description string
+	Parse       func(r io.Reader, opts Options) (*Result, error)
+	// Write exports rules and reports the ones that could not be written
+	// exactly.
+	Write func(w io.Writer, rules []types.RuleRes) ([]Issue, error)
+}
+
+var formats = map[string]Format{}
+
+func register(f Format) {
+	formats[f.Name] = f
+}
+
+// Lookup returns the format with the given name.
+func Lookup(name string) (Format, error) {
+	f, ok := formats[name]
+	if !ok {
+		return Format{}, fmt.Errorf("unknown format %q (want %s)", name, strings.Join(FormatNames(), ", "))
+	}
+	return f, nil
+}
+
+// FormatNames returns the names of all formats, sorted.
+func FormatNames() []string {
+	names := make([]string, 0, len(formats))
+	for name := range formats {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// idnaProfile maps names like a resolver would, but leaves the character
+// check to validLabel so that underscores are accepted.
+var idnaProfile = idna.New(idna.MapForLookup(), idna.BidiRule(), idna.StrictDomainName(false))
+
+// NormalizeDomain lowercases a domain name, strips the trailing dot and
+// converts internationalized names to punycode.
+func NormalizeDomain(s string) (string, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), ".")
+	if s == "" {
+		return "", errors.New("empty domain")
+	}
+	ascii, err := idnaProfile.ToASCII(s)
+	if err != nil {
+		return "", fmt.Errorf("invalid domain: %w", err)
+	}
+	if len(ascii) > 253 {
+		return "", errors.New("invalid domain: longer than 253 characters")
+	}
+	for _, label := range strings.Split(ascii, ".") {
+		if !validLabel(label) {
+			return "", fmt.Errorf("invalid domain: bad label %q", label)
+		}
+	}
+	return ascii, nil
+}
+
+// validLabel accepts letters, digits, hyphens and underscores (used by
+// SRV and DKIM names), 1 to 63 characters long.
+func validLabel(label string) bool {
+	if len(label) == 0 || len(label) > 63 {
+		return false
+	}
+	for i := 0; i < len(label); i++ {
+		c := label[i]
+		if !(c >= 'a' && c <= 'z' || c >= '0' && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
+
+// normalizeWildcard normalizes the labels of a wildcard pattern that
+// contain no wildcard characters.
+func normalizeWildcard(s string) (string, error) {
+	s = strings.TrimSuffix(strings.TrimSpace(s), ".")
+	labels := strings.Split(s, ".")
+	for i, label := range labels {
+		if label == "" {
+			return "", errors.New("empty label in wildcard")
+		}
+		if strings.ContainsAny(label, "*?") {
+			label = strings.ToLower(label)
+			if label != "*" && !validLabel(strings.NewReplacer("*", "", "?", "a").Replace(label)) {
+				return "", fmt.Errorf("invalid wildcard: bad label %q", label)
+			}
+			labels[i] = label
+			continue
+		}
+		ascii, err := idnaProfile.ToASCII(label)
+		if err != nil {
+			return "", fmt.Errorf("invalid wildcard: %w", err)
+		}
+		if !validLabel(ascii) {
+			return "", fmt.Errorf("invalid wildcard: bad label %q", label)
+		}
+		labels[i] = ascii
+	}
+	return strings.Join(labels, "."), nil
+}
+
+// ParseEntry converts a single list entry into a rule. Recognized forms:
+//
+//	example.com           plain domain, opts.DomainType
+//	.example.com          domain and subdomains (namespace)
+//	*.example.com         wildcard (also any entry with * or ?)
+//	/^ads?\./             regular expression
+//	192.0.2.0/24, 2001:db8::/32, 192.0.2.1
+//	                      subnet or subnet6
+//	full:, domain:, keyword:, regexp:
+//	                      v2fly-style prefixes
+func ParseEntry(entry string, opts Options) (types.RuleReq, error) {
+	rule := types.RuleReq{Enable: true}
+
+	switch {
+	case strings.HasPrefix(entry, "full:"):
+		return domainRule(strings.TrimPrefix(entry, "full:"), TypeDomain)
+	case strings.HasPrefix(entry, "domain:"):
+		return domainRule(strings.TrimPrefix(entry, "domain:"), TypeNamespace)
+	case strings.HasPrefix(entry, "keyword:"):
+		keyword := strings.ToLower(strings.TrimPrefix(entry, "keyword:"))
+		if keyword == "" || strings.ContainsAny(keyword, "*? ") {
+			return rule, errors.New("invalid keyword")
+		}
+		rule.Type, rule.Rule = TypeWildcard, "*"+keyword+"*"
+		return rule, nil
+	case strings.HasPrefix(entry, "regexp:"):
+		return regexRule(strings.TrimPrefix(entry, "regexp:"))
+	case len(entry) > 2 && strings.HasPrefix(entry, "/") && strings.HasSuffix(entry, "/"):
+		return regexRule(entry[1 : len(entry)-1])
+	case strings.ContainsAny(entry, "*?"):
+		pattern, err := normalizeWildcard(entry)
+		if err != nil {
+			return rule, err
+		}
+		rule.Type, rule.Rule = TypeWildcard, pattern
+		return rule, nil
+	case strings.HasPrefix(entry, "."):
+		return domainRule(strings.TrimPrefix(entry, "."), TypeNamespace)
+	}
+
+	if subnet, ok := parseSubnet(entry); ok {
+		return subnet, nil
+	}
+	return domainRule(entry, opts.domainType())
+}
+
+func domainRule(s, ruleType string) (types.RuleReq, error) {
+	domain, err := NormalizeDomain(s)
+	if err != nil {
+		return types.RuleReq{}, err
+	}
+	return types.RuleReq{Type: ruleType, Rule: domain, Enable: true}, nil
+}
+
+func regexRule(expr string) (types.RuleReq, error) {
+	if _, err := regexp.Compile(expr); err != nil {
+		return types.RuleReq{}, fmt.Errorf("invalid regex: %w", err)
+	}
+	return types.RuleReq{Type: TypeRegex, Rule: expr, Enable: true}, nil
+}
+
+// parseSubnet accepts CIDRs and single addresses, which become /32 or /128.
+func parseSubnet(s string) (types.RuleReq, bool) {
+	var prefix netip.Prefix
+	if strings.Contains(s, "/") {
+		p, err := netip.ParsePrefix(s)
+		if err != nil {
+			return types.RuleReq{}, false
+		}
+		prefix = p.Masked()
+	} else {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return types.RuleReq{}, false
+		}
+		addr = addr.Unmap()
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+
+	ruleType := TypeSubnet
+	if prefix.Addr().Is6() {
+		ruleType = TypeSubnet6
+	}
+	return types.RuleReq{Type: ruleType, Rule: prefix.String(), Enable: true}, true
+}
@@ -0,0 +1,221 @@
+package ruleset
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+)
+
+func init() {
+	register(Format{
+		Name:        "singbox",
+		Description: "sing-box source rule-set (JSON)",
+		Parse:       ParseSingBox,
+		Write:       WriteSingBox,
+	})
+}
+
+// singBoxRuleSet is a sing-box source rule-set. Only headless rules with
+// domain and IP fields are converted.
+type singBoxRuleSet struct {
+	Version int                          `json:"version"`
+	Rules   []map[string]json.RawMessage `json:"rules"`
+}
+
+// singBoxRule is the headless rule written by WriteSingBox.
+type singBoxRule struct {
+	Domain        []string `json:"domain,omitempty"`
+	DomainSuffix  []string `json:"domain_suffix,omitempty"`
+	DomainKeyword []string `json:"domain_keyword,omitempty"`
+	DomainRegex   []string `json:"domain_regex,omitempty"`
+	IPCIDR        []string `json:"ip_cidr,omitempty"`
+}
+
+// ParseSingBox reads a sing-box source rule-set:
+//
+//	domain          exact domain
+//	domain_suffix   namespace, or a *. wildcard if it starts with a dot
+//	domain_keyword  wildcard *keyword*
+//	domain_regex    regex
+//	ip_cidr         subnet or subnet6
+//
+// Rules using other fields only match a subset of these domains in
+// sing-box; the other fields are dropped and reported. Inverted and
+// logical rules are skipped.
+func ParseSingBox(r io.Reader, _ Options) (*Result, error) {
+	content, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(content, []byte("SRS")) {
+		return nil, errors.New("binary rule-sets are not supported, convert them with 'sing-box rule-set decompile'")
+	}
+
+	var ruleSet singBoxRuleSet
+	if err := json.Unmarshal(content, &ruleSet); err != nil {
+		return nil, fmt.Errorf("failed to parse sing-box rule-set: %w", err)
+	}
+
+	res := &Result{}
+	for i, fields := range ruleSet.Rules {
+		ref := fmt.Sprintf("rules[%d]", i)
+		if raw, ok := fields["type"]; ok && string(raw) != `"default"` {
+			res.issue(0, ref, "logical rules are not supported")
+			continue
+		}
+		if raw, ok := fields["invert"]; ok && string(raw) == "true" {
+			res.issue(0, ref, "inverted rules are not supported")
+			continue
+		}
+
+		for _, name := range singBoxFields {
+			raw, ok := fields[name]
+			if !ok {
+				continue
+			}
+			values, err := singBoxValues(raw)
+			if err != nil {
+				res.issue(0, ref+"."+name, err.Error())
+				continue
+			}
+			for _, value := range values {
+				rule, err := singBoxEntry(name, value)
+				if err != nil {
+					res.issue(0, value, err.Error())
+					continue
+				}
+				res.add(rule)
+			}
+		}
+
+		var ignored []string
+		for name := range fields {
+			if !isSingBoxField(name) && name != "type" && name != "invert" {
+				ignored = append(ignored, name)
+			}
+		}
+		if len(ignored) > 0 {
+			sort.Strings(ignored)
+			res.issue(0, ref, "fields "+strings.Join(ignored, ", ")+" ignored, the rule now matches more")
+		}
+	}
+	return res, nil
+}
+
+// singBoxFields are the converted fields, in output order.
+var singBoxFields = []string{"domain", "domain_suffix", "domain_keyword", "domain_regex", "ip_cidr"}
+
+func isSingBoxField(name string) bool {
+	for _, field := range singBoxFields {
+		if field == name {
+			return true
+		}
+	}
+	return false
+}
+
+// singBoxValues decodes a field that may be a string or a list of strings.
+func singBoxValues(raw json.RawMessage) ([]string, error) {
+	var single string
+	if err := json.Unmarshal(raw, &single); err == nil {
+		return []string{single}, nil
+	}
+	var values []string
+	if err := json.Unmarshal(raw, &values); err != nil {
+		return nil, errors.New("expected a string or a list of strings")
+	}
+	return values, nil
+}
+
+func singBoxEntry(field, value string) (types.RuleReq, error) {
+	switch field {
+	case "domain":
+		return domainRule(value, TypeDomain)
+	case "domain_suffix":
+		if strings.HasPrefix(value, ".") {
+			pattern, err := normalizeWildcard("*" + value)
+			return types.RuleReq{Type: TypeWildcard, Rule: pattern, Enable: true}, err
+		}
+		return domainRule(value, TypeNamespace)
+	case "domain_keyword":
+		return ParseEntry("keyword:"+value, Options{})
+	case "domain_regex":
+		return regexRule(value)
+	default:
+		if rule, ok := parseSubnet(value); ok {
+			return rule, nil
+		}
+		return types.RuleReq{}, errors.New("invalid CIDR")
+	}
+}
+
+// WriteSingBox writes all rules as a single headless rule of a version 1
+// source rule-set. Disabled rules are left out.
+func WriteSingBox(w io.Writer, rules []types.RuleRes) ([]Issue, error) {
+	var issues []Issue
+	var out singBoxRule
+	for _, r := range rules {
+		if !r.Enable {
+			issues = append(issues, ruleIssue(r, "disabled rule left out"))
+			continue
+		}
+		switch r.Type {
+		case TypeDomain:
+			out.Domain = append(out.Domain, r.Rule)
+		case TypeNamespace:
+			out.DomainSuffix = append(out.DomainSuffix, r.Rule)
+		case TypeWildcard:
+			if keyword, ok := wildcardKeyword(r.Rule); ok {
+				out.DomainKeyword = append(out.DomainKeyword, keyword)
+				if strings.Contains(keyword, ".") {
+					issues = append(issues, ruleIssue(r, literalDotIssue))
+				}
+			} else if suffix, ok := wildcardSuffix(r.Rule); ok {
+				out.DomainSuffix = append(out.DomainSuffix, suffix)
+				issues = append(issues, ruleIssue(r, literalDotIssue))
+			} else {
+				out.DomainRegex = append(out.DomainRegex, wildcardToRegex(r.Rule))
+			}
+		case TypeRegex:
+			out.DomainRegex = append(out.DomainRegex, r.Rule)
+		case TypeSubnet, TypeSubnet6:
+			out.IPCIDR = append(out.IPCIDR, r.Rule)
+		default:
+			issues = append(issues, ruleIssue(r, "unknown rule type"))
+		}
+	}
+
+	doc := struct {
+		Version int           `json:"version"`
+		Rules   []singBoxRule `json:"rules"`
+	}{Version: 1, Rules: []singBoxRule{out}}
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return issues, enc.Encode(doc)
+}
+
+// wildcardKeyword recognizes *keyword* patterns.
+func wildcardKeyword(pattern string) (string, bool) {
+	if len(pattern) < 3 || !strings.HasPrefix(pattern, "*") || !strings.HasSuffix(pattern, "*") {
+		return "", false
+	}
+	keyword := pattern[1 : len(pattern)-1]
+	return keyword, !strings.ContainsAny(keyword, "*?")
+}
+
+// wildcardSuffix recognizes *.example.com, which is close to the suffix
+// .example.com; the daemon also lets every . match any character.
+func wildcardSuffix(pattern string) (string, bool) {
+	suffix, ok := strings.CutPrefix(pattern, "*.")
+	if !ok || strings.ContainsAny(suffix, "*?") {
+		return "", false
+	}
+	return "." + suffix, true
+}
@@ -0,0 +1,180 @@
+package ruleset
+
+import (
+	"errors"
+	"fmt"
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+// RuleTypes are the rule types in the order they are documented.
+var RuleTypes = []string{TypeDomain, TypeNamespace, TypeWildcard, TypeRegex, TypeSubnet, TypeSubnet6}
+
+// Validate checks a rule before it is sent to the daemon. It returns the
+// normalized value and warnings about rules that are valid but probably
+// not what was meant. An error means the rule is invalid or can never
+// match.
+func Validate(ruleType, value string) (string, []string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return "", nil, errors.New("empty rule")
+	}
+
+	switch ruleType {
+	case TypeDomain:
+		return validateDomain(value)
+	case TypeNamespace:
+		return validateNamespace(value)
+	case TypeWildcard:
+		return validateWildcard(value)
+	case TypeRegex:
+		return validateRegex(value)
+	case TypeSubnet:
+		return validateSubnet(value, false)
+	case TypeSubnet6:
+		return validateSubnet(value, true)
+	}
+	return "", nil, fmt.Errorf("unknown rule type %q (want %s)", ruleType, strings.Join(RuleTypes, ", "))
+}
+
+// hostLike rejects values that are not host names at all, with a hint at
+// the rule type that was probably meant.
+func hostLike(value string) error {
+	switch {
+	case strings.ContainsAny(value, "/:"):
+		if _, err := netip.ParsePrefix(value); err == nil {
+			return errors.New("looks like a CIDR, use type subnet or subnet6")
+		}
+		if _, err := netip.ParseAddr(value); err == nil {
+			return errors.New("looks like an IP address, use type subnet or subnet6")
+		}
+		return errors.New("looks like a URL, give only the host name")
+	case strings.ContainsAny(value, "*?"):
+		return errors.New("contains wildcard characters, use type wildcard")
+	}
+	if _, err := netip.ParseAddr(value); err == nil {
+		return errors.New("looks like an IP address, use type subnet or subnet6")
+	}
+	return nil
+}
+
+func validateDomain(value string) (string, []string, error) {
+	if err := hostLike(value); err != nil {
+		return "", nil, err
+	}
+	domain, err := NormalizeDomain(value)
+	if err != nil {
+		return "", nil, err
+	}
+	var warnings []string
+	if !strings.Contains(domain, ".") {
+		warnings = append(warnings, "has no dot, is the top-level domain missing?")
+	}
+	return domain, warnings, nil
+}
+
+func validateNamespace(value string) (string, []string, error) {
+	var warnings []string
+	if trimmed, ok := strings.CutPrefix(value, "*."); ok {
+		value = trimmed
+		warnings = append(warnings, "namespaces include all subdomains, the *. prefix was removed")
+	}
+	value = strings.TrimPrefix(value, ".")
+	if err := hostLike(value); err != nil {
+		return "", nil, err
+	}
+	domain, err := NormalizeDomain(value)
+	if err != nil {
+		return "", nil, err
+	}
+	if !strings.Contains(domain, ".") {
+		warnings = append(warnings, "matches every domain under the top-level domain ."+domain)
+	}
+	return domain, warnings, nil
+}
+
+func validateWildcard(value string) (string, []string, error) {
+	pattern, err := normalizeWildcard(value)
+	if err != nil {
+		return "", nil, err
+	}
+	var warnings []string
+	switch {
+	case strings.Trim(pattern, "*.") == "":
+		warnings = append(warnings, "matches every domain")
+	case !strings.ContainsAny(pattern, "*?"):
+		warnings = append(warnings, "has no * or ?, type domain matches the same")
+	}
+	return pattern, warnings, nil
+}
+
+// unescapedDot finds a dot between letters, which in a domain regex is
+// almost always meant literally.
+var unescapedDot = regexp.MustCompile(`[a-z0-9]\.[a-z]`)
+
+func validateRegex(value string) (string, []string, error) {
+	re, err := regexp.Compile(value)
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid regex: %w", err)
+	}
+
+	var warnings []string
+	if re.MatchString("") && re.MatchString("example.invalid") {
+		warnings = append(warnings, "matches every domain")
+	}
+	if !strings.HasPrefix(value, "^") && !strings.HasSuffix(value, "$") {
+		warnings = append(warnings, "not anchored, matches anywhere in the name (add ^ and $)")
+	}
+	if unescapedDot.MatchString(value) {
+		warnings = append(warnings, `unescaped "." matches any character, use \. for a literal dot`)
+	}
+	if !strings.Contains(value, "(?i)") && hasLiteralUpper(value) {
+		warnings = append(warnings, "domain names are matched in lowercase, uppercase letters never match")
+	}
+	return value, warnings, nil
+}
+
+// hasLiteralUpper reports uppercase letters that are not part of an escape
+// such as \D or \S.
+func hasLiteralUpper(expr string) bool {
+	for i := 0; i < len(expr); i++ {
+		if expr[i] >= 'A' && expr[i] <= 'Z' && (i == 0 || expr[i-1] != '\\') {
+			return true
+		}
+	}
+	return false
+}
+
+func validateSubnet(value string, ipv6 bool) (string, []string, error) {
+	var warnings []string
+	prefix, err := netip.ParsePrefix(value)
+	if err != nil {
+		addr, addrErr := netip.ParseAddr(value)
+		if addrErr != nil {
+			return "", nil, fmt.Errorf("invalid CIDR: %w", err)
+		}
+		prefix = netip.PrefixFrom(addr, addr.BitLen())
+	}
+	if prefix.Addr().Is4In6() {
+		return "", nil, errors.New("IPv4-mapped address, use type subnet with the IPv4 address")
+	}
+	if prefix.Addr().Zone() != "" {
+		return "", nil, errors.New("zones are not supported in subnets")
+	}
+
+	switch {
+	case ipv6 && prefix.Addr().Is4():
+		return "", nil, errors.New("IPv4 subnet, use type subnet")
+	case !ipv6 && prefix.Addr().Is6():
+		return "", nil, errors.New("IPv6 subnet, use type subnet6")
+	}
+	if masked := prefix.Masked(); masked != prefix {
+		warnings = append(warnings, "host bits set, normalized to "+masked.String())
+		prefix = masked
+	}
+	if prefix.Bits() == 0 {
+		warnings = append(warnings, "matches every address")
+	}
+	return prefix.String(), warnings, nil
+}
@@ -0,0 +1,229 @@
+// Package source keeps MagiTrickle groups in sync with rule lists published
+// over HTTP.
+//
+// A Source ties a group to a URL and a ruleset format. Fetch downloads the
+// list, using the ETag and Last-Modified of the previous download to skip
+// unchanged lists, and Merge replaces the rules the source added earlier
+// while leaving all other rules of the group alone:
+//
+//	f := source.Fetcher{}
+//	dl, err := f.Fetch(ctx, src)
+//	res, err := src.Parse(dl.Body)
+//	rules, managed, stats := source.Merge(current, src.Managed, nil, res.Rules)
+package source
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+
+	"magitrickle-cli/constant"
+	"magitrickle-cli/ruleset"
+)
+
+// DefaultTimeout is used when Fetcher.HTTPClient is nil.
+const DefaultTimeout = time.Minute
+
+// MaxSize limits the size of a downloaded list.
+const MaxSize = 64 << 20
+
+// Source is a rule list that is mirrored into a group, together with the
+// state of its last synchronization.
+type Source struct {
+	Name string `json:"name"`
+	// Server is the daemon the group belongs to.
+	Server  string `json:"server"`
+	GroupID string `json:"group_id"`
+	URL     string `json:"url"`
+	// Format is a ruleset format name; DomainType and Categories are
+	// passed to its parser.
+	Format     string   `json:"format"`
+	DomainType string   `json:"domain_type,omitempty"`
+	Categories []string `json:"categories,omitempty"`
+	// Interval is the minimum time between two scheduled syncs, as accepted
+	// by time.ParseDuration. Empty means every sync.
+	Interval string `json:"interval,omitempty"`
+
+	ETag         string    `json:"etag,omitempty"`
+	LastModified string    `json:"last_modified,omitempty"`
+	LastSync     time.Time `json:"last_sync"`
+	// Managed holds the ruleset.Key of every rule the source added.
+	Managed []string `json:"managed,omitempty"`
+}
+
+// Due reports whether the interval since the last sync has passed at now.
+func (s *Source) Due(now time.Time) bool {
+	if s.Interval == "" || s.LastSync.IsZero() {
+		return true
+	}
+	interval, err := time.ParseDuration(s.Interval)
+	if err != nil {
+		return true
+	}
+	return !now.Before(s.LastSync.Add(interval))
+}
+
+// Parse converts a downloaded list with the source's format.
+func (s *Source) Parse(body []byte) (*ruleset.Result, error) {
+	format, err := ruleset.Lookup(s.Format)
+	if err != nil {
+		return nil, err
+	}
+	if format.Parse == nil {
+		return nil, fmt.Errorf("format %s cannot be imported", s.Format)
+	}
+	return format.Parse(bytes.NewReader(body), ruleset.Options{DomainType: s.DomainType, Categories: s.Categories})
+}
+
+// Download is the result of Fetch.
+type Download struct {
+	// NotModified is set when the server answered 304; Body is empty then.
+	NotModified  bool
+	Body         []byte
+	ETag         string
+	LastModified string
+}
+
+// Fetcher downloads sources. The zero value uses an HTTP client with
+// DefaultTimeout.
+type Fetcher struct {
+	// HTTPClient overrides the HTTP client (useful in tests).
+	HTTPClient *http.Client
+	// Force ignores the cached ETag and Last-Modified of the source.
+	Force bool
+	// MaxSize overrides the size limit of a list. Defaults to MaxSize.
+	MaxSize int64
+}
+
+// Fetch downloads the list of s. Unless f.Force is set, the request is
+// conditional on the ETag and Last-Modified of the previous download.
+func (f *Fetcher) Fetch(ctx context.Context, s *Source) (*Download, error) {
+	httpClient := f.HTTPClient
+	if httpClient == nil {
+		httpClient = &http.Client{Timeout: DefaultTimeout}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "magitrickle-cli/"+constant.Version)
+	if !f.Force {
+		if s.ETag != "" {
+			req.Header.Set("If-None-Match", s.ETag)
+		}
+		if s.LastModified != "" {
+			req.Header.Set("If-Modified-Since", s.LastModified)
+		}
+	}
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	dl := &Download{ETag: resp.Header.Get("ETag"), LastModified: resp.Header.Get("Last-Modified")}
+	switch {
+	case resp.StatusCode == http.StatusNotModified:
+		dl.NotModified = true
+		// A 304 may omit the validators; keep the ones we sent.
+		if dl.ETag == "" {
+			dl.ETag = s.ETag
+		}
+		if dl.LastModified == "" {
+			dl.LastModified = s.LastModified
+		}
+		return dl, nil
+	case resp.StatusCode != http.StatusOK:
+		return nil, fmt.Errorf("GET %s: %s", s.URL, resp.Status)
+	}
+
+	limit := f.MaxSize
+	if limit <= 0 {
+		limit = MaxSize
+	}
+	dl.Body, err = io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, fmt.Errorf("GET %s: %w", s.URL, err)
+	}
+	if int64(len(dl.Body)) > limit {
+		return nil, fmt.Errorf("GET %s: list is larger than %d bytes", s.URL, limit)
+	}
+	return dl, nil
+}
+
+// Stats counts the changes made by Merge.
+type Stats struct {
+	// Added and Removed are rules of the source; Kept are fetched rules
+	// that were already in the group.
+	Added, Removed, Kept int
+}
+
+// Changed reports whether the rules of the group change.
+func (s Stats) Changed() bool {
+	return s.Added > 0 || s.Removed > 0
+}
+
+// Merge returns the new rules of a group and the keys the source manages
+// afterwards. Rules in managed that are no longer fetched are removed, new
+// ones are appended. Rules the group already had for other reasons are
+// kept as they are and do not become managed, so they survive the source
+// dropping them.
+//
+// shared holds the keys managed by other sources of the same group. Their
+// rules are never removed, and the source manages them as well once it
+// fetches them, so they stay as long as any of the sources lists them.
+func Merge(current []types.RuleRes, managed, shared []string, fetched []types.RuleReq) ([]types.RuleReq, []string, Stats) {
+	var stats Stats
+	isManaged := make(map[string]bool, len(managed))
+	for _, key := range managed {
+		isManaged[key] = true
+	}
+	isShared := make(map[string]bool, len(shared))
+	for _, key := range shared {
+		isShared[key] = true
+	}
+	wanted := make(map[string]bool, len(fetched))
+	for _, r := range fetched {
+		wanted[ruleset.Key(r.Type, r.Rule)] = true
+	}
+
+	rules := make([]types.RuleReq, 0, len(current)+len(fetched))
+	var nowManaged []string
+	present := make(map[string]bool, len(current))
+	for _, r := range current {
+		key := ruleset.Key(r.Type, r.Rule)
+		if isManaged[key] && !wanted[key] && !isShared[key] {
+			stats.Removed++
+			continue
+		}
+		if isManaged[key] && wanted[key] && !present[key] {
+			nowManaged = append(nowManaged, key)
+		}
+		present[key] = true
+		id := r.ID
+		rules = append(rules, types.RuleReq{ID: &id, Name: r.Name, Type: r.Type, Rule: r.Rule, Enable: r.Enable})
+	}
+
+	for _, r := range fetched {
+		key := ruleset.Key(r.Type, r.Rule)
+		if present[key] {
+			if isShared[key] && !isManaged[key] {
+				nowManaged = append(nowManaged, key)
+			}
+			stats.Kept++
+			continue
+		}
+		present[key] = true
+		rules = append(rules, r)
+		nowManaged = append(nowManaged, key)
+		stats.Added++
+	}
+	return rules, nowManaged, stats
+}
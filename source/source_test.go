@@ -0,0 +1,250 @@
+package source
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Ponywka/MagiTrickle/backend/pkg/api/types"
+
+	"magitrickle-cli/ruleset"
+)
+
+const (
+	testETag         = `"v1"`
+	testLastModified = "Mon, 02 Jan 2006 15:04:05 GMT"
+	testList         = "example.com\nexample.org\n"
+)
+
+// newListServer serves testList with validators and answers 304 to
+// matching conditional requests. The last request is stored in last.
+func newListServer(t *testing.T, last **http.Request) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*last = r
+		if r.Header.Get("If-None-Match") == testETag || r.Header.Get("If-Modified-Since") == testLastModified {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", testETag)
+		w.Header().Set("Last-Modified", testLastModified)
+		_, _ = w.Write([]byte(testList))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchConditional(t *testing.T) {
+	var last *http.Request
+	srv := newListServer(t, &last)
+	f := Fetcher{HTTPClient: srv.Client()}
+	src := &Source{URL: srv.URL + "/list.txt", Format: "list"}
+
+	dl, err := f.Fetch(context.Background(), src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if dl.NotModified || string(dl.Body) != testList {
+		t.Fatalf("first fetch: NotModified=%v body=%q", dl.NotModified, dl.Body)
+	}
+	if dl.ETag != testETag || dl.LastModified != testLastModified {
+		t.Fatalf("first fetch: validators %q %q", dl.ETag, dl.LastModified)
+	}
+	if h := last.Header.Get("If-None-Match"); h != "" {
+		t.Errorf("first fetch sent If-None-Match %q", h)
+	}
+	if ua := last.Header.Get("User-Agent"); !strings.HasPrefix(ua, "magitrickle-cli/") {
+		t.Errorf("User-Agent = %q", ua)
+	}
+
+	tests := []struct {
+		name               string
+		etag, lastModified string
+		force              bool
+		notModified        bool
+	}{
+		{name: "etag", etag: testETag, notModified: true},
+		{name: "last-modified", lastModified: testLastModified, notModified: true},
+		{name: "both", etag: testETag, lastModified: testLastModified, notModified: true},
+		{name: "stale etag", etag: `"v0"`},
+		{name: "force", etag: testETag, lastModified: testLastModified, force: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			src := &Source{URL: srv.URL, ETag: tt.etag, LastModified: tt.lastModified}
+			f := Fetcher{HTTPClient: srv.Client(), Force: tt.force}
+			dl, err := f.Fetch(context.Background(), src)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if dl.NotModified != tt.notModified {
+				t.Fatalf("NotModified = %v, want %v", dl.NotModified, tt.notModified)
+			}
+
+			wantETag, wantLM := tt.etag, tt.lastModified
+			if tt.force {
+				wantETag, wantLM = "", ""
+			}
+			if got := last.Header.Get("If-None-Match"); got != wantETag {
+				t.Errorf("If-None-Match = %q, want %q", got, wantETag)
+			}
+			if got := last.Header.Get("If-Modified-Since"); got != wantLM {
+				t.Errorf("If-Modified-Since = %q, want %q", got, wantLM)
+			}
+
+			if tt.notModified {
+				// The 304 has no validators; the ones sent are kept.
+				if len(dl.Body) != 0 || dl.ETag != tt.etag || dl.LastModified != tt.lastModified {
+					t.Errorf("304: body=%q etag=%q last-modified=%q", dl.Body, dl.ETag, dl.LastModified)
+				}
+			} else if string(dl.Body) != testList || dl.ETag != testETag {
+				t.Errorf("200: body=%q etag=%q", dl.Body, dl.ETag)
+			}
+		})
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/big":
+			_, _ = w.Write([]byte(strings.Repeat("a", 101)))
+		case "/limit":
+			_, _ = w.Write([]byte(strings.Repeat("a", 100)))
+		case "/missing":
+			http.NotFound(w, r)
+		default:
+			http.Error(w, "boom", http.StatusInternalServerError)
+		}
+	}))
+	defer srv.Close()
+
+	tests := []struct {
+		path    string
+		wantErr string
+	}{
+		{"/limit", ""},
+		{"/big", "larger than 100 bytes"},
+		{"/missing", "404 Not Found"},
+		{"/fail", "500 Internal Server Error"},
+	}
+	for _, tt := range tests {
+		f := Fetcher{HTTPClient: srv.Client(), MaxSize: 100}
+		dl, err := f.Fetch(context.Background(), &Source{URL: srv.URL + tt.path})
+		if tt.wantErr == "" {
+			if err != nil || len(dl.Body) != 100 {
+				t.Errorf("%s: err=%v", tt.path, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("%s: err = %v, want %q", tt.path, err, tt.wantErr)
+		}
+	}
+}
+
+func TestMerge(t *testing.T) {
+	res := func(id byte, typ, rule string) types.RuleRes {
+		return types.RuleRes{ID: types.ID{id}, Name: "r", Type: typ, Rule: rule, Enable: true}
+	}
+	req := func(typ, rule string) types.RuleReq {
+		return types.RuleReq{Type: typ, Rule: rule, Enable: true}
+	}
+	key := ruleset.Key
+
+	current := []types.RuleRes{
+		res(1, "namespace", "hand.example"),    // added by hand
+		res(2, "namespace", "dropped.example"), // managed, gone upstream
+		res(3, "namespace", "kept.example"),    // managed, still listed
+		res(4, "domain", "both.example"),       // by hand, now also listed
+	}
+	managed := []string{
+		key("namespace", "dropped.example"),
+		key("namespace", "kept.example"),
+	}
+	fetched := []types.RuleReq{
+		req("namespace", "kept.example"),
+		req("domain", "both.example"),
+		req("namespace", "new.example"),
+	}
+
+	rules, nowManaged, stats := Merge(current, managed, nil, fetched)
+
+	var got []string
+	for _, r := range rules {
+		got = append(got, r.Type+" "+r.Rule)
+	}
+	want := []string{
+		"namespace hand.example",
+		"namespace kept.example",
+		"domain both.example",
+		"namespace new.example",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("rules = %q, want %q", got, want)
+	}
+	if rules[0].ID == nil || *rules[0].ID != (types.ID{1}) || rules[0].Name != "r" {
+		t.Errorf("existing rule lost its ID or name: %+v", rules[0])
+	}
+	if rules[3].ID != nil {
+		t.Errorf("new rule has an ID: %v", rules[3].ID)
+	}
+
+	wantManaged := []string{key("namespace", "kept.example"), key("namespace", "new.example")}
+	if !reflect.DeepEqual(nowManaged, wantManaged) {
+		t.Errorf("managed = %q, want %q", nowManaged, wantManaged)
+	}
+	if want := (Stats{Added: 1, Removed: 1, Kept: 2}); stats != want {
+		t.Errorf("stats = %+v, want %+v", stats, want)
+	}
+
+	// The source dropping a rule that was added by hand keeps the rule.
+	rules, _, stats = Merge(current[:1], nil, nil, nil)
+	if len(rules) != 1 || stats.Changed() {
+		t.Errorf("hand-added rule not kept: %d rules, %+v", len(rules), stats)
+	}
+}
+
+func TestMergeShared(t *testing.T) {
+	res := func(id byte, rule string) types.RuleRes {
+		return types.RuleRes{ID: types.ID{id}, Type: "namespace", Rule: rule, Enable: true}
+	}
+	req := func(rule string) types.RuleReq {
+		return types.RuleReq{Type: "namespace", Rule: rule, Enable: true}
+	}
+	key := func(rule string) string { return ruleset.Key("namespace", rule) }
+
+	// Sources A and B both publish both.example; A also had a.example.
+	current := []types.RuleRes{res(1, "both.example"), res(2, "a.example"), res(3, "b.example")}
+	managedA := []string{key("both.example"), key("a.example")}
+	managedB := []string{key("both.example"), key("b.example")}
+
+	// A drops both rules: only the one B does not manage goes.
+	rules, nowManaged, stats := Merge(current, managedA, managedB, nil)
+	var got []string
+	for _, r := range rules {
+		got = append(got, r.Rule)
+	}
+	if want := []string{"both.example", "b.example"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("rules = %q, want %q", got, want)
+	}
+	if len(nowManaged) != 0 || stats != (Stats{Removed: 1}) {
+		t.Errorf("managed = %q, stats = %+v", nowManaged, stats)
+	}
+
+	// B already lists a.example: once fetched it manages it too, so A
+	// dropping it later keeps the rule.
+	_, nowManaged, stats = Merge(current, managedB, managedA, []types.RuleReq{req("both.example"), req("b.example"), req("a.example")})
+	if want := []string{key("both.example"), key("b.example"), key("a.example")}; !reflect.DeepEqual(nowManaged, want) {
+		t.Errorf("managed = %q, want %q", nowManaged, want)
+	}
+	if stats != (Stats{Kept: 3}) || stats.Changed() {
+		t.Errorf("stats = %+v", stats)
+	}
+	rules, _, _ = Merge(current, managedA, nowManaged, nil)
+	if len(rules) != 3 {
+		t.Errorf("%d rules left, want 3", len(rules))
+	}
+}